@@ -0,0 +1,134 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	encunicode "golang.org/x/text/encoding/unicode"
+)
+
+var xmlEncodingRe = regexp.MustCompile(`^\s*<\?xml[^>]*\bencoding\s*=\s*["']([^"']+)["']`)
+
+// cyrillicCharsets are the legacy encodings of Russian text that the
+// old backups come in, to guess from when nothing says which one it is.
+var cyrillicCharsets = []encoding.Encoding{
+	charmap.Windows1251,
+	charmap.KOI8R,
+	charmap.CodePage866,
+}
+
+// frequentCyrillic are the most frequent letters of Russian text.
+const frequentCyrillic = "оеаинтсрвлкмдпу"
+
+// detectEncoding finds out the encoding of the page: the charset if it's
+// set, the byte order mark, the one the page states in its meta
+// tags or XML declaration, UTF-8 if the page is valid UTF-8, or the
+// legacy Cyrillic encoding the text makes most sense in. It returns the
+// page without the byte order mark.
+func detectEncoding(b []byte, charset encoding.Encoding) (encoding.Encoding, []byte) {
+	if charset != nil {
+		return charset, bomless(b)
+	}
+
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return encunicode.UTF8, b[3:]
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return encunicode.UTF16(encunicode.LittleEndian, encunicode.ExpectBOM), b
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return encunicode.UTF16(encunicode.BigEndian, encunicode.ExpectBOM), b
+	}
+
+	if d, err := goquery.NewDocumentFromReader(bytes.NewReader(b)); err == nil {
+		if e := getEncoding(d.Find("html")); e != nil {
+			return e, b
+		}
+	}
+
+	if m := xmlEncodingRe.FindSubmatch(b); m != nil {
+		if e, err := htmlindex.Get(string(m[1])); err == nil {
+			return e, b
+		}
+	}
+
+	if utf8.Valid(b) {
+		return encunicode.UTF8, b
+	}
+	return guessCyrillic(b), b
+}
+
+func bomless(b []byte) []byte {
+	return bytes.TrimPrefix(b, []byte{0xef, 0xbb, 0xbf})
+}
+
+// guessCyrillic returns the legacy Cyrillic encoding the text looks the
+// most like Russian in.
+func guessCyrillic(b []byte) encoding.Encoding {
+	best, bestScore := cyrillicCharsets[0], -1<<31
+	for _, e := range cyrillicCharsets {
+		d, err := e.NewDecoder().Bytes(b)
+		if err != nil {
+			continue
+		}
+		if s := cyrillicScore(string(d)); s > bestScore {
+			best, bestScore = e, s
+		}
+	}
+	return best
+}
+
+// cyrillicScore tells how much the text looks like Russian: frequent
+// lowercase letters count for it, capitals in the middle of words and
+// pseudographics count against it.
+func cyrillicScore(s string) int {
+	score := 0
+	var prev rune
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(frequentCyrillic, r):
+			score++
+		case unicode.Is(unicode.Cyrillic, r) && unicode.IsUpper(r) && unicode.IsLetter(prev) && unicode.IsLower(prev):
+			score -= 2
+		case r >= 0x2500 && r <= 0x25ff:
+			score -= 2
+		}
+		prev = r
+	}
+	return score
+}
+
+// metaCharset returns the charset the content of a http-equiv meta tag
+// has, like "text/html; charset=windows-1251".
+func metaCharset(content string) string {
+	_, params, err := mime.ParseMediaType(content)
+	if err != nil {
+		if i := strings.Index(strings.ToLower(content), "charset="); i >= 0 {
+			return strings.Trim(strings.TrimSpace(content[i+len("charset="):]), `"';`)
+		}
+		return ""
+	}
+	return params["charset"]
+}
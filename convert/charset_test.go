@@ -0,0 +1,94 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const charsetText = "<p>Сегодня был у друзей, и мы долго говорили о том, что осталось от старого журнала.</p>"
+
+func encode(t *testing.T, e encoding.Encoding, s string) []byte {
+	b, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := map[string]struct {
+		b        []byte
+		override encoding.Encoding
+		want     string
+	}{
+		"utf-8":    {[]byte(charsetText), nil, "utf-8"},
+		"bom":      {append([]byte{0xef, 0xbb, 0xbf}, charsetText...), nil, "utf-8"},
+		"meta":     {[]byte(`<html><head><meta charset="koi8-r"></head></html>`), nil, "koi8-r"},
+		"spacing":  {[]byte(`<html><head><META HTTP-EQUIV="content-type" CONTENT="text/html;charset=Windows-1251"></head></html>`), nil, "windows-1251"},
+		"xml":      {[]byte(`<?xml version="1.0" encoding="KOI8-R"?><event></event>`), nil, "koi8-r"},
+		"cp1251":   {encode(t, charmap.Windows1251, charsetText), nil, "windows-1251"},
+		"koi8-r":   {encode(t, charmap.KOI8R, charsetText), nil, "koi8-r"},
+		"cp866":    {encode(t, charmap.CodePage866, charsetText), nil, "ibm866"},
+		"override": {encode(t, charmap.KOI8R, charsetText), charmap.Windows1251, "windows-1251"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, _ := detectEncoding(tc.b, tc.override)
+			got, _ := htmlindex.Name(e)
+			assertString(t, tc.want, got)
+		})
+	}
+
+	t.Run("utf-16", func(t *testing.T) {
+		e, b := detectEncoding([]byte{0xff, 0xfe, '<', 0, 'p', 0, '>', 0}, nil)
+		got, err := e.NewDecoder().Bytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, "<p>", string(got))
+	})
+}
+
+func TestLoadLegacyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "koi8.html")
+	if err := ioutil.WriteFile(fn, encode(t, charmap.KOI8R, "<html><body>"+charsetText+"</body></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadHtmlFile(fn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Find("body").Html()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, charsetText, got)
+}
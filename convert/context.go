@@ -0,0 +1,218 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const contextSummaryLength = 280
+
+// replyContext is what we know about a post that is replied to, liked
+// or reposted.
+type replyContext struct {
+	Url       string         `toml:"url"`
+	Name      string         `toml:"name,omitempty"`
+	Summary   string         `toml:"summary,omitempty"`
+	Published string         `toml:"published,omitempty"`
+	Photo     string         `toml:"photo,omitempty"`
+	Author    *contextAuthor `toml:"author,omitempty"`
+}
+
+type contextAuthor struct {
+	Name  string `toml:"name,omitempty"`
+	Url   string `toml:"url,omitempty"`
+	Photo string `toml:"photo,omitempty"`
+}
+
+// contextCache makes sure every URL is only fetched once per converter,
+// even if many posts that are processed at once refer to it.
+type contextCache struct {
+	sync.Mutex
+	m     map[string]*contextEntry
+	fetch func(string) (*goquery.Document, error)
+	log   *Logger
+}
+
+// contextEntry is the reply context of a URL; done is closed once it's
+// fetched.
+type contextEntry struct {
+	done chan struct{}
+	rc   *replyContext
+}
+
+func newContextCache(fetch func(string) (*goquery.Document, error), log *Logger) *contextCache {
+	return &contextCache{m: map[string]*contextEntry{}, fetch: fetch, log: log}
+}
+
+// get returns the reply contexts for the given URLs, skipping those
+// that could not be fetched.
+func (c *contextCache) get(urls ...string) []replyContext {
+	var out []replyContext
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		if rc := c.getOne(u); rc != nil {
+			out = append(out, *rc)
+		}
+	}
+	return out
+}
+
+// getOne returns the reply context of the URL, fetching it if no one
+// has yet, or waiting for the one who is fetching it.
+func (c *contextCache) getOne(u string) *replyContext {
+	c.Lock()
+	e, ok := c.m[u]
+	if !ok {
+		e = &contextEntry{done: make(chan struct{})}
+		c.m[u] = e
+	}
+	c.Unlock()
+	if ok {
+		<-e.done
+		return e.rc
+	}
+
+	defer close(e.done)
+	d, err := c.fetch(u)
+	if err != nil {
+		c.log.Warn("failed to fetch reply context", "url", u, "error", err)
+		return nil
+	}
+	e.rc = parseReplyContext(d.Find("html"), u)
+	return e.rc
+}
+
+// parseReplyContext extracts the h-entry data of the page, falling back
+// to OpenGraph for whatever is missing.
+func parseReplyContext(sel *goquery.Selection, u string) *replyContext {
+	rc := &replyContext{Url: u}
+	base, _ := url.Parse(u)
+
+	if e := sel.Find(".h-entry").First(); e.Length() > 0 {
+		rc.Name = mfText(e, ".p-name")
+		rc.Summary = mfText(e, ".p-summary")
+		if rc.Summary == "" {
+			rc.Summary = truncate(mfText(e, ".e-content"), contextSummaryLength)
+		}
+		if rc.Name == rc.Summary {
+			rc.Name = ""
+		}
+		rc.Published, _ = e.Find(".dt-published").First().Attr("datetime")
+		rc.Photo = mfURL(mfFind(e, ".u-photo"), base)
+
+		a := e.Find(".p-author.h-card, .h-card").First()
+		if a.Length() > 0 {
+			ca := &contextAuthor{
+				Name:  mfText(a, ".p-name"),
+				Url:   mfURL(a.Find(".u-url").First(), base),
+				Photo: mfURL(a.Find(".u-photo").First(), base),
+			}
+			if ca.Name == "" {
+				ca.Name = strings.TrimSpace(a.Text())
+			}
+			if ca.Url == "" {
+				ca.Url = mfURL(a, base)
+			}
+			rc.Author = ca
+		}
+	}
+
+	og := openGraph(sel)
+	if rc.Name == "" {
+		rc.Name = og["og:title"]
+	}
+	if rc.Summary == "" {
+		rc.Summary = og["og:description"]
+	}
+	if rc.Published == "" {
+		rc.Published = og["article:published_time"]
+	}
+	if rc.Photo == "" && og["og:image"] != "" {
+		rc.Photo = resolveURL(base, og["og:image"])
+	}
+	if rc.Author == nil {
+		name := og["article:author"]
+		if name == "" {
+			name = og["og:site_name"]
+		}
+		if name != "" {
+			rc.Author = &contextAuthor{Name: name}
+		}
+	}
+	return rc
+}
+
+func openGraph(sel *goquery.Selection) map[string]string {
+	og := map[string]string{}
+	sel.Find("meta").Each(func(_ int, s *goquery.Selection) {
+		p, ok := s.Attr("property")
+		if !ok {
+			p, _ = s.Attr("name")
+		}
+		if _, ok := og[p]; ok || p == "" {
+			return
+		}
+		og[p], _ = s.Attr("content")
+	})
+	return og
+}
+
+// mfFind returns the first element with the class that is a property
+// of sel itself rather than of an h-card nested in it.
+func mfFind(sel *goquery.Selection, class string) *goquery.Selection {
+	return sel.Find(class).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return !s.Is(".h-card") && s.ParentsUntilSelection(sel).Filter(".h-card").Length() == 0
+	}).First()
+}
+
+func mfText(sel *goquery.Selection, class string) string {
+	if sel.Is(".h-card") {
+		return plainText(sel.Find(class).First())
+	}
+	return plainText(mfFind(sel, class))
+}
+
+// plainText returns the text of the selection with the whitespace
+// collapsed and the block elements separated.
+func plainText(sel *goquery.Selection) string {
+	c := sel.Clone()
+	c.Find("p, div, br, li, blockquote, h1, h2, h3, h4, h5, h6").AfterHtml(" ")
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
+
+func mfURL(sel *goquery.Selection, base *url.URL) string {
+	for _, a := range []string{"href", "src", "data"} {
+		if v, ok := sel.Attr(a); ok && base != nil {
+			return resolveURL(base, v)
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseReplyContext(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want replyContext
+	}{
+		"h-entry": {`<html><body><article class="h-entry">
+<a class="p-author h-card" href="/me"><img class="u-photo" src="/me.jpg">Jane Doe</a>
+<h1 class="p-name">A post</h1>
+<time class="dt-published" datetime="2020-03-01T10:00:00+00:00">March 1</time>
+<div class="e-content">Some   text
+here</div>
+<img class="u-photo" src="pic.jpg">
+</article></body></html>`, replyContext{
+			Url:       "https://other.site/2020/post",
+			Name:      "A post",
+			Summary:   "Some text here",
+			Published: "2020-03-01T10:00:00+00:00",
+			Photo:     "https://other.site/2020/pic.jpg",
+			Author:    &contextAuthor{Name: "Jane Doe", Url: "https://other.site/me", Photo: "https://other.site/me.jpg"},
+		}},
+		"opengraph": {`<html><head>
+<meta property="og:title" content="Title">
+<meta property="og:description" content="Description">
+<meta property="og:image" content="/img.png">
+<meta property="og:site_name" content="Other Site">
+<meta property="article:published_time" content="2020-03-02">
+</head></html>`, replyContext{
+			Url:       "https://other.site/2020/post",
+			Name:      "Title",
+			Summary:   "Description",
+			Published: "2020-03-02",
+			Photo:     "https://other.site/img.png",
+			Author:    &contextAuthor{Name: "Other Site"},
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := parseReplyContext(d.Find("html"), "https://other.site/2020/post")
+			if !reflect.DeepEqual(&tc.want, got) {
+				t.Fatalf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestContextCache(t *testing.T) {
+	var fetched int32
+	c := newContextCache(func(u string) (*goquery.Document, error) {
+		atomic.AddInt32(&fetched, 1)
+		time.Sleep(10 * time.Millisecond)
+		f, err := os.Open(filepath.Join("testdata", "tired.html"))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return goquery.NewDocumentFromReader(f)
+	}, defaultLogger)
+
+	u := "https://evgenykuznetsov.org/2020/двигаться-дальше"
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.get(u, "")
+		}()
+	}
+	wg.Wait()
+	got := c.get(u)
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Fatalf("fetched %d times", n)
+	}
+	if len(got) != 1 || got[0].Name != "Двигаться дальше…" {
+		t.Fatalf("unexpected context: %+v", got)
+	}
+}
+
+func TestReplyTargets(t *testing.T) {
+	fm := map[string]interface{}{
+		"reply_to":  []string{"https://example.site/1"},
+		"like_of":   "https://example.site/2",
+		"repost_of": "https://example.site/3",
+	}
+	got := replyTargets(fm)
+	want := []string{"https://example.site/1", "https://example.site/2", "https://example.site/3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
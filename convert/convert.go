@@ -0,0 +1,346 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Package convert converts blog posts to Hugo page bundles: the posts of
+// a Known website, and the ones from the local backups of the blogs the
+// importers know.
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+// Known is the kind of website known-to-hugo scrapes, for ConvertHTML.
+const Known = "known"
+
+// Options are the settings of a Converter.
+type Options struct {
+	// Website is the Known website to scrape; the links to it in the
+	// posts are made relative.
+	Website string
+	// Section is the section of the Known website to scrape, like
+	// "/content/posts", or "" for the default content.
+	Section string
+	// Draft marks every post as a draft.
+	Draft bool
+	// Concurrency is how many Known posts are processed at once.
+	Concurrency int
+	// Format is the output format: "md", "html", or "hybrid" for HTML
+	// only where markdown would lose formatting.
+	Format string
+	// Embeds is a comma-separated list of the embeds to convert to Hugo
+	// shortcodes.
+	Embeds string
+	// ReplyContexts fetches the reply contexts for replies, likes and
+	// reposts.
+	ReplyContexts bool
+	// AutoTitles makes up titles for the untitled posts from their first
+	// sentence, of TitleWords words at most, and slugs for those that only
+	// have IDs.
+	AutoTitles bool
+	TitleWords int
+	// Slugs are the slugs to save the posts under: "keep", "gost" or
+	// "passport" to transliterate, or "id".
+	Slugs string
+	// Summaries adds summaries and descriptions to the front matter.
+	Summaries bool
+	// Lang detects the language of each post and saves it as the "key"
+	// in the front matter or in the content "file" name.
+	Lang string
+	// Hashtags adds the #hashtags found in the posts to their tags, and
+	// links them to the tag pages under HashtagBase, if it's set.
+	Hashtags    bool
+	HashtagBase string
+	// LJSecurity is what to do with the LiveJournal entries that are not
+	// public: "publish", "draft" or "skip", for all of them or per level,
+	// like "friends=draft,private=skip".
+	LJSecurity string
+	// LJScreened keeps the screened LiveJournal comments.
+	LJScreened bool
+	// Charset is the encoding of the local backup files, if it can't be
+	// detected.
+	Charset string
+	// Logger is the log of the conversion; the records of LevelInfo and
+	// above go to the standard error if it's not set.
+	Logger *Logger
+}
+
+// DefaultOptions returns the options known-to-hugo runs with by default.
+func DefaultOptions() Options {
+	return Options{
+		Section:     "/content/posts",
+		Concurrency: 15,
+		Format:      formatMarkdown,
+		Embeds:      allEmbeds(),
+		TitleWords:  10,
+		Slugs:       slugKeep,
+		LJSecurity:  policyDraft,
+	}
+}
+
+// Bundle is a converted post: a Hugo page bundle with the content file,
+// the images and the comments.
+type Bundle struct {
+	// Path is where the bundle goes under the output directory, like
+	// "2020/slug".
+	Path string
+	// Files are the contents of the files in the bundle, by their names.
+	Files map[string][]byte
+	// AssetErrors are the errors fetching the images and the files of
+	// the post; the files that failed keep their URLs in the content.
+	AssetErrors []error
+}
+
+// Write saves the bundle under the directory.
+func (b *Bundle) Write(dir string) error {
+	out := filepath.Join(dir, filepath.FromSlash(b.Path))
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	for fn, content := range b.Files {
+		if err := ioutil.WriteFile(filepath.Join(out, fn), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Converter converts posts to bundles with its options. It keeps the
+// reply contexts and the LiveJournal comments it has read for as long as
+// it's used. It's safe to use from many goroutines.
+type Converter struct {
+	stats    Progress
+	opts     Options
+	policy   map[string]string
+	charset  encoding.Encoding
+	log      *Logger
+	contexts *contextCache
+	comments ljxCommentCache
+
+	defImgOnce sync.Once
+	defImg     string
+
+	failMu   sync.Mutex
+	failures []*ItemError
+}
+
+// New returns the Converter with the options, or an error if any of them
+// is not one it knows.
+func New(o Options) (*Converter, error) {
+	policy, err := parseSecurityPolicy(o.LJSecurity)
+	if err != nil {
+		return nil, fmt.Errorf("LiveJournal security policy: %w", err)
+	}
+	if err := checkFormat(o.Format); err != nil {
+		return nil, err
+	}
+	if err := checkSlugs(o.Slugs); err != nil {
+		return nil, err
+	}
+	if err := checkLang(o.Lang); err != nil {
+		return nil, err
+	}
+	var charset encoding.Encoding
+	if o.Charset != "" {
+		if charset, err = htmlindex.Get(o.Charset); err != nil {
+			return nil, fmt.Errorf("%s: unknown charset", o.Charset)
+		}
+	}
+	if o.Website != "" && !strings.HasPrefix(o.Website, "http://") && !strings.HasPrefix(o.Website, "https://") {
+		o.Website = "http://" + o.Website
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	log := o.Logger
+	if log == nil {
+		log = defaultLogger
+	}
+	return &Converter{
+		opts:     o,
+		policy:   policy,
+		charset:  charset,
+		log:      log,
+		contexts: newContextCache(getPage, log),
+	}, nil
+}
+
+// ljOptions returns the settings the LiveJournal entries are converted
+// with.
+func (c *Converter) ljOptions() ljOptions {
+	return ljOptions{policy: c.policy, keepScreened: c.opts.LJScreened}
+}
+
+// defaultImage returns the image the Known website has for the posts
+// that have none of their own.
+func (c *Converter) defaultImage() string {
+	c.defImgOnce.Do(func() {
+		if c.opts.Website != "" {
+			c.defImg = getDefaultImage(c.opts.Website)
+		}
+	})
+	return c.defImg
+}
+
+// ConvertURL converts the Known post at the URL. The error it returns
+// is an *ItemError.
+func (c *Converter) ConvertURL(u string) (*Bundle, error) {
+	d, err := getPage(u)
+	if err != nil {
+		return nil, itemError(u, StageFetch, err)
+	}
+	return c.knownBundle(d.Find("html"), u, c.defaultImage())
+}
+
+// ConvertHTML converts the post that is an HTML page of the kind of
+// website: a Known post, or a page of the HTML backup of the kind an
+// importer has. It returns nil if the post is to be skipped.
+func (c *Converter) ConvertHTML(r io.Reader, kind string) (*Bundle, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseHtml(b, c.charset)
+	if err != nil {
+		return nil, err
+	}
+	if kind == Known {
+		return c.knownBundle(s, getPermalink(s), c.defaultImage())
+	}
+
+	blogType, ok := htmlTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("%s: no HTML pages to convert", kind)
+	}
+	p, err := c.htmlPage(s, blogType, "")
+	if p == nil || err != nil {
+		return nil, err
+	}
+	url := p.canonicalUrl()
+	return c.pageBundle(p, strings.TrimSuffix(url, filepath.Ext(url)))
+}
+
+// ConvertFile converts the posts in the file of a local backup of the
+// kind of website, or of the kind the file looks like if it's not set.
+// The posts that fail are left out, and their failures are added to the
+// converter's Failures, like the ones of ImportDir; the error, an
+// *ItemError, is the failure of the first of them. The files of the
+// posts that failed to be fetched are in the AssetErrors of their
+// bundles, too.
+func (c *Converter) ConvertFile(path, kind string) ([]*Bundle, error) {
+	imp, err := lookupImporter(kind)
+	if kind == "" {
+		imp, err = detectFile(path)
+	}
+	if err != nil {
+		err := itemError(path, StageLoad, err)
+		c.addFailures([]*ItemError{err})
+		return nil, err
+	}
+	bundles, errs := c.importBundles(path, imp)
+	c.addFailures(errs)
+	for _, err := range errs {
+		if err.Stage != StageAsset {
+			return bundles, err
+		}
+	}
+	return bundles, nil
+}
+
+// ImportDir converts the local backup in the directory and saves the
+// bundles to the output directory. The kind of website is detected if
+// it's not set. The posts that fail are skipped, and their failures are
+// added to the converter's Failures.
+func (c *Converter) ImportDir(dir, kind, output string) error {
+	imp, err := lookupImporter(kind)
+	if kind == "" {
+		var ok bool
+		if imp, ok = importer.Detect(dir); ok {
+			c.log.Info("detected the kind of website", "dir", dir, "type", imp.Name)
+			err = nil
+		} else {
+			err = errUnknownKind
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	c.addFailures(c.blogDir(dir, output, imp))
+	return nil
+}
+
+// Scrape converts the posts of the Known website and saves the bundles
+// to the output directory. The posts that fail are skipped, and their
+// failures are added to the converter's Failures.
+func (c *Converter) Scrape(output string) error {
+	if c.opts.Website == "" {
+		return fmt.Errorf("no website to scrape")
+	}
+	pages := c.getPostLinks(c.opts.Website + c.opts.Section)
+	c.addFailures(c.processPages(pages, c.defaultImage(), output))
+	return nil
+}
+
+// Progress returns how far ImportDir and Scrape have got so far. It can
+// be called while they run.
+func (c *Converter) Progress() Progress {
+	return c.stats.load()
+}
+
+// Failures returns the failures of the posts ConvertFile, ImportDir and
+// Scrape have converted so far.
+func (c *Converter) Failures() []*ItemError {
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	return append([]*ItemError(nil), c.failures...)
+}
+
+func (c *Converter) addFailures(errs []*ItemError) {
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	c.failures = append(c.failures, errs...)
+}
+
+var errUnknownKind = errors.New("can't tell what kind of website this is, set it")
+
+// lookupImporter returns the importer for the kind of website.
+func lookupImporter(kind string) (importer.Importer, error) {
+	if imp, ok := importer.Lookup(kind); ok {
+		return imp, nil
+	}
+	return importer.Importer{}, fmt.Errorf("%s: not implemented", kind)
+}
+
+// detectFile returns the importer the file looks like it's for.
+func detectFile(path string) (importer.Importer, error) {
+	for _, imp := range importer.All() {
+		if imp.Detect != nil && imp.Detect(path) {
+			return imp, nil
+		}
+	}
+	return importer.Importer{}, errUnknownKind
+}
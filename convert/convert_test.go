@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertFile(t *testing.T) {
+	c, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := c.ConvertFile(filepath.Join("testdata", "ljdump", "L-664"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 1 {
+		t.Fatalf("want 1 bundle, got %d", len(bundles))
+	}
+	b := bundles[0]
+	if b.Path != "2008/170041" {
+		t.Errorf("want 2008/170041, got %s", b.Path)
+	}
+	assertGolden(t, b.Files["index.md"], filepath.Join("testdata", "ljdump.md"))
+	assertGolden(t, b.Files["webmentions.json"], filepath.Join("testdata", "ljdump.json"))
+
+	if _, err := c.ConvertFile(filepath.Join("testdata", "gp_takeout.jpg"), ""); err == nil {
+		t.Error("want an error for a file of no known kind")
+	}
+}
+
+func TestConvertFileOptions(t *testing.T) {
+	c := testConverter(t, func(o *Options) { o.Format, o.LJScreened = formatHTML, true })
+	bundles, err := c.ConvertFile(filepath.Join("testdata", "ljdump", "L-664"), "lj_xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 1 {
+		t.Fatalf("want 1 bundle, got %d", len(bundles))
+	}
+	b := bundles[0]
+	if _, ok := b.Files["index.html"]; !ok {
+		t.Errorf("want index.html, got %v", b.Files)
+	}
+	if !bytes.Contains(b.Files["webmentions.json"], []byte(`"state": "screened"`)) {
+		t.Errorf("want the screened comments kept, got:\n%s", b.Files["webmentions.json"])
+	}
+}
+
+func TestConvertHTML(t *testing.T) {
+	o := DefaultOptions()
+	o.Draft = true
+	c, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ioutil.ReadFile(filepath.Join("testdata", "tired.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.ConvertHTML(bytes.NewReader(h), Known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Path != "2020/двигаться-дальше" {
+		t.Errorf("want 2020/двигаться-дальше, got %s", b.Path)
+	}
+	if !bytes.Contains(b.Files["index.md"], []byte("draft = true")) {
+		t.Errorf("want a draft, got:\n%s", b.Files["index.md"])
+	}
+
+	b, err = testConverter(t).ConvertHTML(bytes.NewReader(h), Known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Files["index.md"], []byte("draft = false")) {
+		t.Errorf("the options of one converter are used by another:\n%s", b.Files["index.md"])
+	}
+
+	if _, err := c.ConvertHTML(bytes.NewReader(nil), "lj_xml"); err == nil {
+		t.Error("want an error for a kind with no HTML pages")
+	}
+}
+
+func TestNew(t *testing.T) {
+	bad := map[string]func(*Options){
+		"policy":  func(o *Options) { o.LJSecurity = "secret" },
+		"slugs":   func(o *Options) { o.Slugs = "gots" },
+		"format":  func(o *Options) { o.Format = "markdown" },
+		"lang":    func(o *Options) { o.Lang = "auto" },
+		"charset": func(o *Options) { o.Charset = "klingon" },
+	}
+	for name, set := range bad {
+		t.Run(name, func(t *testing.T) {
+			o := DefaultOptions()
+			set(&o)
+			if _, err := New(o); err == nil {
+				t.Fatal("want an error")
+			}
+		})
+	}
+
+	o := DefaultOptions()
+	o.Charset = "windows-1251"
+	if _, err := New(o); err != nil {
+		t.Fatal(err)
+	}
+
+	o = DefaultOptions()
+	o.Website = "example.site"
+	c, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.opts.Website != "http://example.site" {
+		t.Fatalf("want http://example.site, got %s", c.opts.Website)
+	}
+}
+
+func TestBundleWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Bundle{Path: "2020/post", Files: map[string][]byte{"index.md": []byte("post")}}
+	if err := b.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "2020", "post", "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "post" {
+		t.Fatalf("want post, got %s", got)
+	}
+}
@@ -13,7 +13,7 @@
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 
-package main
+package convert
 
 import (
 	"encoding/json"
@@ -24,6 +24,27 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
+const diaryGuest = "Гость"
+
+// diaryAccessMark is how diary.ru starts the note on who can read the
+// post, like "Доступ: только для избранных", on the lock icon of the post
+// or next to its title.
+const diaryAccessMark = "доступ:"
+
+// diaryAccess are the access levels of the posts that are not public, by
+// the words of the diary.ru note.
+var diaryAccess = []struct {
+	hint, level string
+}{
+	{"избранн", "favorites"},
+	{"постоянных читател", "subscribers"},
+	{"подписчик", "subscribers"},
+	{"белого списка", "whitelist"},
+	{"белый список", "whitelist"},
+	{"для себя", "private"},
+	{"закрыт", "private"},
+}
+
 type diaryPage struct {
 	*goquery.Selection
 }
@@ -79,11 +100,62 @@ func (p diaryPage) date() time.Time {
 
 func (p diaryPage) content() pageContent {
 	s := p.Find(".singlePost").Find(".postInner")
+	convertDiaryMarkup(s)
 	return pageContent{s}
 }
 
+func (p diaryPage) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if t := diaryMoreTitle(p.Find(".singlePost").Find(".postInner")); t != "" {
+		params["read_more"] = t
+	}
+	if a := p.access(); a != "" {
+		params["access"] = a
+		params["draft"] = true
+	}
+	return params
+}
+
 func (p diaryPage) tags() []string {
-	return nil
+	var t []string
+	p.Find(".singlePost").Find(`a[href*="?tag="], a[href*="&tag="]`).Each(func(_ int, s *goquery.Selection) {
+		if s.ParentsFiltered(".postInner").Length() > 0 {
+			return
+		}
+		if tag := strings.TrimSpace(s.Text()); tag != "" {
+			t = mergeTags(t, []string{tag})
+		}
+	})
+	return t
+}
+
+// access returns the access level of the post, or an empty string if the
+// post is public.
+func (p diaryPage) access() string {
+	var hints []string
+	post := p.Find(".singlePost")
+	post.Find("[title], [alt]").Each(func(_ int, s *goquery.Selection) {
+		if s.ParentsFiltered(".postInner").Length() == 0 {
+			hints = append(hints, s.AttrOr("title", ""), s.AttrOr("alt", ""))
+		}
+	})
+	post.Find(".access, .postTitle").Each(func(_ int, s *goquery.Selection) {
+		hints = append(hints, s.Clone().Find("h1").Remove().End().Text())
+	})
+	for _, h := range hints {
+		h = strings.ToLower(h)
+		i := strings.Index(h, diaryAccessMark)
+		if i < 0 {
+			continue
+		}
+		h = h[i+len(diaryAccessMark):]
+		for _, a := range diaryAccess {
+			if strings.Contains(h, a.hint) {
+				return a.level
+			}
+		}
+	}
+	return ""
 }
 
 func (p diaryPage) webmentions() []byte {
@@ -109,9 +181,13 @@ func (p diaryPage) webmentions() []byte {
 }
 
 func (dc diaryComment) author() author {
-	n := dc.Find(".authorName").Text()
+	n := strings.TrimSpace(dc.Find(".authorName").Text())
 	p, _ := dc.Find(".commentAuthor").Find("img").Attr("src")
-	return author{"card", n, "", p}
+	var u string
+	if n != "" && n != diaryGuest {
+		u = diaryUserURL(n)
+	}
+	return author{Type: "card", Name: n, Url: u, Photo: p}
 }
 
 func (dc diaryComment) content() content {
@@ -119,7 +195,7 @@ func (dc diaryComment) content() content {
 	t := strings.TrimSpace(c.Text())
 	h, _ := c.Html()
 	h = strings.TrimSpace(h)
-	return content{t, h}
+	return content{Text: t, Html: h}
 }
 
 func (dc diaryComment) date() string {
@@ -129,5 +205,10 @@ func (dc diaryComment) date() string {
 }
 
 func (dc diaryComment) url() string {
-	return ""
+	id := strings.TrimPrefix(dc.AttrOr("id", ""), "comment")
+	u := dc.Closest("html").Find(`link[rel="canonical"]`).AttrOr("href", "")
+	if id == "" || u == "" {
+		return ""
+	}
+	return u + "#" + id
 }
@@ -0,0 +1,87 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDiaryAccess(t *testing.T) {
+	lock := `<img src="https://static.diary.ru/img/lock.gif" title="Доступ: только для избранных" />`
+	tests := map[string]struct {
+		header, want string
+	}{
+		"favorites":  {lock, "favorites"},
+		"whitelist":  {`<span class="access">Доступ: только для белого списка</span>`, "whitelist"},
+		"public":     {"", ""},
+		"not a mark": {`<img src="cat.gif" title="Белый кот закрыт только дома" />`, ""},
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "diary_markup.htm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s, err := parseHtml(bytes.Replace(b, []byte(lock), []byte(tc.header), 1), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := diaryPage{s}
+			params := p.params()
+			if got, _ := params["access"].(string); got != tc.want {
+				t.Errorf("want access %q, got %q", tc.want, got)
+			}
+			if _, ok := params["draft"]; ok != (tc.want != "") {
+				t.Errorf("want draft %v, got %v", tc.want != "", params["draft"])
+			}
+			assertString(t, "Разметка", p.title())
+		})
+	}
+}
+
+func TestDiaryUsers(t *testing.T) {
+	tests := map[string]struct {
+		html, want string
+	}{
+		"user":         {"[L]nekr0z[/L]", `<a href="https://www.diary.ru/member/?nekr0z">nekr0z</a>`},
+		"journal":      {"[J]nekr0z[/J]", `<a href="https://www.diary.ru/~nekr0z/">nekr0z</a>`},
+		"user link":    {`<a class="TagL" href="/member/?12345">Белый кот</a>`, `<a href="https://www.diary.ru/member/?%D0%91%D0%B5%D0%BB%D1%8B%D0%B9+%D0%BA%D0%BE%D1%82">Белый кот</a>`},
+		"journal link": {`<a class="TagJ" href="/~cat/">cat</a>`, `<a href="https://www.diary.ru/~cat/">cat</a>`},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader("<div>" + tc.html + "</div>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := d.Find("div")
+			convertDiaryBBCode(s)
+			convertDiaryUsers(s)
+			got, _ := s.Html()
+			assertString(t, tc.want, got)
+		})
+	}
+}
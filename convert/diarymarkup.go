@@ -0,0 +1,262 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	diaryMoreLink    = ".LinkMore"
+	diaryMoreContent = ".MoreHidden, .MoreVisible, [id^=more]"
+	diaryMoreText    = "Читать дальше"
+)
+
+var (
+	diaryMoreRe    = regexp.MustCompile(`(?i)\[MORE(?:=([^\]]*))?\]`)
+	diaryMoreEndRe = regexp.MustCompile(`(?i)\[/MORE\]`)
+	diaryUserRe    = regexp.MustCompile(`(?i)\[([LJ])\](.+?)\[/[LJ]\]`)
+	diarySmileRe   = regexp.MustCompile(`^:[\w-]+:$`)
+)
+
+// diarySmilies are the diary.ru built-in smilies by their codes.
+var diarySmilies = map[string]string{
+	":)":        "🙂",
+	":-)":       "🙂",
+	":(":        "🙁",
+	":-(":       "🙁",
+	":D":        "😃",
+	":-D":       "😃",
+	";)":        "😉",
+	";-)":       "😉",
+	":p":        "😛",
+	":-p":       "😛",
+	":-/":       "😕",
+	":tongue:":  "😛",
+	":lol:":     "😆",
+	":laugh:":   "😂",
+	":gigi:":    "😄",
+	":weep:":    "😭",
+	":tear:":    "😢",
+	":hmm:":     "🤔",
+	":susp:":    "🤨",
+	":shy:":     "😊",
+	":red:":     "😳",
+	":wow:":     "😮",
+	":crazy:":   "🤪",
+	":alles:":   "😵",
+	":apstenu:": "🤦",
+	":nope:":    "🙅",
+	":yes:":     "👍",
+	":vo:":      "👍",
+	":bravo:":   "👏",
+	":inlove:":  "😍",
+	":wine:":    "🍷",
+	":beer:":    "🍺",
+	":dance:":   "💃",
+	":ura:":     "🎉",
+	":pozdr:":   "🎉",
+	":hang:":    "😫",
+	":evil:":    "😈",
+	":angel:":   "😇",
+	":cool:":    "😎",
+	":sleep:":   "😴",
+	":friend:":  "🤝",
+	":duel:":    "🤺",
+}
+
+// convertDiaryMarkup replaces diary.ru-specific markup, both BBCode left
+// as is and as rendered by diary.ru, with what Hugo can handle.
+func convertDiaryMarkup(s *goquery.Selection) {
+	convertDiaryBBCode(s)
+	convertDiaryMores(s)
+	convertDiaryUsers(s)
+	convertDiarySmilies(s)
+	convertDiaryPolls(s)
+}
+
+// diaryMoreTitle returns the custom text of the first MORE link, which
+// is kept on the post once the link itself is converted.
+func diaryMoreTitle(s *goquery.Selection) string {
+	t, ok := s.Attr("data-read-more")
+	if !ok {
+		t = strings.TrimSpace(s.Find(diaryMoreLink).First().Text())
+	}
+	if t == diaryMoreText {
+		return ""
+	}
+	return t
+}
+
+func convertDiaryBBCode(s *goquery.Selection) {
+	h, _ := s.Html()
+	if !diaryMoreRe.MatchString(h) && !diaryUserRe.MatchString(h) {
+		return
+	}
+	h = diaryMoreRe.ReplaceAllStringFunc(h, func(m string) string {
+		t := diaryMoreRe.FindStringSubmatch(m)[1]
+		if t == "" {
+			t = diaryMoreText
+		}
+		return `<span class="LinkMore">` + t + `</span><span class="MoreHidden">`
+	})
+	h = diaryMoreEndRe.ReplaceAllString(h, "</span>")
+	h = diaryUserRe.ReplaceAllStringFunc(h, func(m string) string {
+		sm := diaryUserRe.FindStringSubmatch(m)
+		return diaryUserHtml(strings.ToUpper(sm[1]) == "J", html.UnescapeString(sm[2]))
+	})
+	s.SetHtml(h)
+}
+
+// convertDiaryMores makes the first MORE the summary divider, and the
+// rest "details" that markdown has a shortcode for.
+func convertDiaryMores(s *goquery.Selection) {
+	s.Find(diaryMoreLink).Each(func(i int, l *goquery.Selection) {
+		c := l.NextAllFiltered(diaryMoreContent).First()
+		if c.Length() == 0 {
+			l.Remove()
+			return
+		}
+		if i == 0 && !hasMore(s) {
+			s.SetAttr("data-read-more", strings.TrimSpace(l.Text()))
+			insertMore(l)
+			c.ReplaceWithSelection(c.Contents())
+			l.Remove()
+			return
+		}
+		t := strings.TrimSpace(l.Text())
+		if t == "" {
+			t = diaryMoreText
+		}
+		c.WrapAllHtml("<details></details>")
+		c.Parent().PrependHtml("<summary>" + html.EscapeString(t) + "</summary>")
+		c.ReplaceWithSelection(c.Contents())
+		l.Remove()
+	})
+	s.Find(`a[name^="more"]`).Remove()
+}
+
+func convertDiaryUsers(s *goquery.Selection) {
+	s.Find("a.TagL, a.TagJ").Each(func(_ int, a *goquery.Selection) {
+		name := strings.TrimSpace(a.Text())
+		if u, err := url.Parse(a.AttrOr("href", "")); name == "" || err == nil && u.IsAbs() {
+			return
+		}
+		a.ReplaceWithHtml(diaryUserHtml(a.HasClass("TagJ"), name))
+	})
+}
+
+// diaryUserHtml returns the link to the diary of the user for [J], or to
+// the user's profile for [L].
+func diaryUserHtml(journal bool, name string) string {
+	u := diaryUserURL(name)
+	if journal {
+		u = diaryJournalURL(name)
+	}
+	return `<a href="` + html.EscapeString(u) + `">` + html.EscapeString(name) + `</a>`
+}
+
+// diaryUserURL returns the URL of the diary.ru user's profile.
+func diaryUserURL(name string) string {
+	return "https://www.diary.ru/member/?" + url.QueryEscape(name)
+}
+
+// diaryJournalURL returns the URL of the diary.ru user's diary.
+func diaryJournalURL(name string) string {
+	return "https://www.diary.ru/~" + url.PathEscape(name) + "/"
+}
+
+func convertDiarySmilies(s *goquery.Selection) {
+	s.Find("img").Each(func(_ int, img *goquery.Selection) {
+		code := strings.TrimSpace(img.AttrOr("alt", img.AttrOr("title", "")))
+		e, ok := diarySmilies[code]
+		if !ok {
+			src := img.AttrOr("src", "")
+			if !diarySmileRe.MatchString(code) &&
+				!(strings.Contains(src, "diary.ru") && strings.Contains(src, "/smil")) {
+				return
+			}
+			e = code
+		}
+		img.ReplaceWithHtml(html.EscapeString(e))
+	})
+}
+
+// convertDiaryPolls replaces the polls with their results as they were
+// when the page was saved.
+func convertDiaryPolls(s *goquery.Selection) {
+	s.Find(".voting, .poll, form").Each(func(_ int, p *goquery.Selection) {
+		if p.ParentsFiltered(".voting, .poll, form").Length() > 0 {
+			return
+		}
+		if !p.Is(".voting, .poll") && p.Find("input[type=radio], input[type=checkbox]").Length() == 0 {
+			return
+		}
+		p.ReplaceWithHtml(diaryPollHtml(p))
+	})
+}
+
+func diaryPollHtml(p *goquery.Selection) string {
+	p = p.Clone()
+	p.Find("input[type=submit], input[type=button], button, script").Remove()
+
+	var q string
+	if h := p.Find("legend, caption, .question, b, strong").First(); h.Length() > 0 {
+		q = plainText(h)
+		h.Remove()
+	}
+
+	var options []string
+	p.Find("tr, li, label").Each(func(_ int, o *goquery.Selection) {
+		if o.Find("tr, li, label").Length() > 0 {
+			return
+		}
+		var cells []string
+		o.Find("td, th").Each(func(_ int, c *goquery.Selection) {
+			if t := plainText(c); t != "" {
+				cells = append(cells, t)
+			}
+		})
+		if len(cells) == 0 {
+			if t := plainText(o); t != "" {
+				cells = append(cells, t)
+			}
+		}
+		if len(cells) > 0 {
+			options = append(options, strings.Join(cells, " — "))
+		}
+	})
+
+	var b strings.Builder
+	b.WriteString(`<div class="poll">`)
+	if q != "" {
+		b.WriteString("<p><strong>" + html.EscapeString(q) + "</strong></p>")
+	}
+	if len(options) > 0 {
+		b.WriteString("<ul>")
+		for _, o := range options {
+			b.WriteString("<li>" + html.EscapeString(o) + "</li>")
+		}
+		b.WriteString("</ul>")
+	}
+	b.WriteString("</div>")
+	return b.String()
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	youtubeRe   = regexp.MustCompile(`(?:youtube(?:-nocookie)?\.com/(?:embed/|v/|watch\?v=)|youtu\.be/)([\w-]+)`)
+	vimeoRe     = regexp.MustCompile(`vimeo\.com/(?:video/|moogaloop\.swf\?clip_id=)?(\d+)`)
+	tweetRe     = regexp.MustCompile(`twitter\.com/(\w+)/status(?:es)?/(\d+)`)
+	instagramRe = regexp.MustCompile(`instagram\.com/(?:p|tv|reel)/([\w-]+)`)
+	gistRe      = regexp.MustCompile(`gist\.github\.com/([\w-]+)/(\w+)`)
+)
+
+// embedRules are the html-to-markdown rules that turn embedded content
+// into Hugo shortcodes, in the order they are applied.
+var embedRules = []struct {
+	name  string
+	rules []md.Rule
+}{
+	{"youtube", []md.Rule{{Filter: []string{"iframe"}, Replacement: srcShortcode(youtube)}}},
+	{"vimeo", []md.Rule{{Filter: []string{"iframe"}, Replacement: srcShortcode(vimeo)}}},
+	{"tweet", []md.Rule{{Filter: []string{"blockquote"}, Replacement: tweetRule}}},
+	{"instagram", []md.Rule{{Filter: []string{"blockquote"}, Replacement: instagramRule}}},
+	{"gist", []md.Rule{{Filter: []string{"script"}, Replacement: srcShortcode(gist)}}},
+	{"figure", []md.Rule{{Filter: []string{"figure"}, Replacement: figureRule}}},
+	// the rule is made by newConverter, as it needs to know the other
+	// embeds enabled
+	{"known", nil},
+}
+
+// allEmbeds is the comma-separated list of all the embed rules.
+func allEmbeds() string {
+	var names []string
+	for _, r := range embedRules {
+		names = append(names, r.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// embedEnabled tells whether the embed rule is listed in embeds.
+func embedEnabled(embeds, name string) bool {
+	for _, n := range strings.Split(embeds, ",") {
+		if strings.TrimSpace(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newConverter returns a html-to-markdown converter with the embed
+// rules listed in embeds enabled.
+func newConverter(embeds string) *md.Converter {
+	converter := md.NewConverter("", true, nil)
+	converter.AddRules(textRule, brRule, emRule, strongRule, moreRule, detailsRule, summaryRule)
+
+	// the rules are tried last to first, so the elements the embed
+	// rules don't recognize need to fall back to the default
+	converter.AddRules(md.Rule{
+		Filter: []string{"div", "figure"},
+		Replacement: func(content string, _ *goquery.Selection, _ *md.Options) *string {
+			return &content
+		},
+	})
+
+	for _, r := range embedRules {
+		if embedEnabled(embeds, r.name) {
+			converter.AddRules(r.rules...)
+		}
+	}
+	if embedEnabled(embeds, "known") {
+		converter.AddRules(md.Rule{Filter: []string{"div"}, Replacement: knownRule(embeds)})
+	}
+	return converter
+}
+
+func srcShortcode(f func(string) string) func(string, *goquery.Selection, *md.Options) *string {
+	return func(_ string, s *goquery.Selection, _ *md.Options) *string {
+		return block(f(s.AttrOr("src", "")))
+	}
+}
+
+func youtube(u string) string {
+	if m := youtubeRe.FindStringSubmatch(u); m != nil {
+		return fmt.Sprintf("{{< youtube %s >}}", m[1])
+	}
+	return ""
+}
+
+func vimeo(u string) string {
+	if m := vimeoRe.FindStringSubmatch(u); m != nil {
+		return fmt.Sprintf("{{< vimeo %s >}}", m[1])
+	}
+	return ""
+}
+
+func tweet(u string) string {
+	if m := tweetRe.FindStringSubmatch(u); m != nil {
+		return fmt.Sprintf(`{{< tweet user="%s" id="%s" >}}`, m[1], m[2])
+	}
+	return ""
+}
+
+func instagram(u string) string {
+	if m := instagramRe.FindStringSubmatch(u); m != nil {
+		return fmt.Sprintf("{{< instagram %s >}}", m[1])
+	}
+	return ""
+}
+
+func gist(u string) string {
+	if m := gistRe.FindStringSubmatch(u); m != nil {
+		return fmt.Sprintf("{{< gist %s %s >}}", m[1], m[2])
+	}
+	return ""
+}
+
+func tweetRule(_ string, s *goquery.Selection, _ *md.Options) *string {
+	if !s.HasClass("twitter-tweet") {
+		return nil
+	}
+	return block(tweet(s.Find("a").Last().AttrOr("href", "")))
+}
+
+func instagramRule(_ string, s *goquery.Selection, _ *md.Options) *string {
+	if !s.HasClass("instagram-media") {
+		return nil
+	}
+	u := s.AttrOr("data-instgrm-permalink", "")
+	if u == "" {
+		u = s.Find("a").First().AttrOr("href", "")
+	}
+	return block(instagram(u))
+}
+
+func figureRule(_ string, s *goquery.Selection, _ *md.Options) *string {
+	img := s.Find("img").First()
+	src := img.AttrOr("src", "")
+	if src == "" {
+		return nil
+	}
+	sc := fmt.Sprintf("{{< figure src=%q", src)
+	if alt := img.AttrOr("alt", ""); alt != "" {
+		sc += fmt.Sprintf(" alt=%q", alt)
+	}
+	if caption := plainText(s.Find("figcaption")); caption != "" {
+		sc += fmt.Sprintf(" caption=%q", caption)
+	}
+	return block(sc + " >}}")
+}
+
+// knownRule returns the rule for the link previews Known renders with
+// JavaScript from empty "unfurl" placeholders; the ones of the embeds
+// enabled become their shortcodes.
+func knownRule(embeds string) func(string, *goquery.Selection, *md.Options) *string {
+	return func(_ string, s *goquery.Selection, _ *md.Options) *string {
+		u, ok := s.Attr("data-url")
+		if !ok || !s.HasClass("unfurl") {
+			return nil
+		}
+		for name, f := range map[string]func(string) string{
+			"youtube":   youtube,
+			"vimeo":     vimeo,
+			"tweet":     tweet,
+			"instagram": instagram,
+			"gist":      gist,
+		} {
+			if sc := f(u); sc != "" && embedEnabled(embeds, name) {
+				return block(sc)
+			}
+		}
+		if u == "" {
+			return md.String("")
+		}
+		return block("<" + u + ">")
+	}
+}
+
+func block(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return md.String("\n\n" + s + "\n\n")
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"testing"
+)
+
+func TestEmbeds(t *testing.T) {
+	tests := map[string]struct {
+		html   string
+		embeds string
+		want   string
+	}{
+		"youtube":           {`<iframe src="https://www.youtube.com/embed/w7Ft2ymGmfc?rel=0"></iframe>`, "youtube", "{{< youtube w7Ft2ymGmfc >}}"},
+		"youtube disabled":  {`<p>a</p><iframe src="https://www.youtube.com/embed/w7Ft2ymGmfc"></iframe>`, "vimeo", "a"},
+		"vimeo":             {`<iframe src="https://player.vimeo.com/video/146022717"></iframe>`, "vimeo", "{{< vimeo 146022717 >}}"},
+		"tweet":             {`<blockquote class="twitter-tweet"><p>Text</p>&mdash; Someone <a href="https://twitter.com/nekr0z/status/1235156965464190977?ref_src=twsrc">March 4, 2020</a></blockquote><script async src="https://platform.twitter.com/widgets.js"></script>`, "tweet", `{{< tweet user="nekr0z" id="1235156965464190977" >}}`},
+		"quote":             {`<blockquote><p>Text</p></blockquote>`, allEmbeds(), "> Text"},
+		"instagram":         {`<blockquote class="instagram-media" data-instgrm-permalink="https://www.instagram.com/p/BWNjjyYFxVx/?utm_source=ig_embed"></blockquote>`, "instagram", "{{< instagram BWNjjyYFxVx >}}"},
+		"gist":              {`<script src="https://gist.github.com/spf13/7896402.js"></script>`, "gist", "{{< gist spf13 7896402 >}}"},
+		"figure":            {`<figure><img src="image0" alt="Alt"><figcaption>A <b>caption</b></figcaption></figure>`, "figure", `{{< figure src="image0" alt="Alt" caption="A caption" >}}`},
+		"figure disabled":   {`<figure><img src="image0" alt="Alt"></figure>`, "", `![Alt](image0)`},
+		"known unfurl":      {`<div class="unfurl" data-url="https://youtu.be/w7Ft2ymGmfc"></div>`, allEmbeds(), "{{< youtube w7Ft2ymGmfc >}}"},
+		"known unfurl link": {`<div class="unfurl" data-url="https://habr.com/ru/post/491672/"></div>`, allEmbeds(), "<https://habr.com/ru/post/491672/>"},
+		"div falls back":    {`<div class="whatever"><p>text</p></div>`, allEmbeds(), "text"},
+		"script is removed": {`<p>text</p><script>alert(1)</script>`, allEmbeds(), "text"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := newConverter(tc.embeds).ConvertString(tc.html)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertString(t, tc.want, got)
+		})
+	}
+}
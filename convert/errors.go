@@ -0,0 +1,91 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// The stages of the conversion a post can fail at.
+const (
+	// StageFetch is getting the post from the website.
+	StageFetch = "fetch"
+	// StageLoad is reading the post and making sense of it.
+	StageLoad = "load"
+	// StageConvert is making the bundle of the post.
+	StageConvert = "convert"
+	// StageAsset is fetching the images and the files of the post; the
+	// post is saved, but the files that failed keep their URLs in the content.
+	StageAsset = "asset"
+	// StageWrite is saving the bundle.
+	StageWrite = "write"
+)
+
+// ItemError is the failure to convert a post, or a part of it.
+type ItemError struct {
+	// Item is the URL or the file of the post.
+	Item  string
+	Stage string
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Item, e.Stage, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON makes the error an entry of the report.
+func (e *ItemError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Item  string `json:"item"`
+		Stage string `json:"stage"`
+		Error string `json:"error"`
+	}{e.Item, e.Stage, e.Err.Error()})
+}
+
+func itemError(item, stage string, err error) *ItemError {
+	if ie, ok := err.(*ItemError); ok {
+		return ie
+	}
+	return &ItemError{Item: item, Stage: stage, Err: err}
+}
+
+// assetErrors returns the errors fetching the files of the bundle as the
+// failures of the post.
+func assetErrors(item string, b *Bundle) []*ItemError {
+	var errs []*ItemError
+	for _, err := range b.AssetErrors {
+		errs = append(errs, itemError(item, StageAsset, err))
+	}
+	return errs
+}
+
+// WriteReport saves the failures to the file as JSON.
+func WriteReport(fn string, errs []*ItemError) error {
+	if errs == nil {
+		errs = []*ItemError{}
+	}
+	b, err := json.MarshalIndent(errs, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, b, 0644)
+}
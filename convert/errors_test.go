@@ -0,0 +1,186 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	errs := []*ItemError{
+		itemError("https://example.site/2020/post", StageFetch, errors.New("404")),
+		itemError("L-1", StageWrite, errors.New("no space")),
+	}
+	fn := filepath.Join(dir, "report.json")
+	if err := WriteReport(fn, errs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+ {
+  "item": "https://example.site/2020/post",
+  "stage": "fetch",
+  "error": "404"
+ },
+ {
+  "item": "L-1",
+  "stage": "write",
+  "error": "no space"
+ }
+]`
+	if string(got) != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestBrokenKnownPost(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "tired.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte(`class="dt-published"`), []byte(`class="published"`), 1)
+
+	c, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.ConvertHTML(bytes.NewReader(b), Known)
+	var ie *ItemError
+	if !errors.As(err, &ie) {
+		t.Fatalf("want an *ItemError, got %v", err)
+	}
+	if ie.Stage != StageLoad {
+		t.Errorf("want %s stage, got %s", StageLoad, ie.Stage)
+	}
+}
+
+func TestImportDirFailures(t *testing.T) {
+	in, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(in)
+	out, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	entry, err := ioutil.ReadFile(filepath.Join("testdata", "ljdump", "L-664"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(in, "L-664"), entry, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(in, "L-665"), []byte("<event>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	o := DefaultOptions()
+	if o.Logger, err = NewLogger(&log, LevelWarn, LogText); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImportDir(in, "", out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2008", "170041", "index.md")); err != nil {
+		t.Errorf("the good entry is not saved: %v", err)
+	}
+	failures := c.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("want 1 failure, got %v", failures)
+	}
+	if failures[0].Stage != StageLoad {
+		t.Errorf("want %s stage, got %s", StageLoad, failures[0].Stage)
+	}
+	if !bytes.Contains(log.Bytes(), []byte("item="+filepath.Join(in, "L-665"))) {
+		t.Errorf("the failure is not logged:\n%s", log.String())
+	}
+	want := Progress{Discovered: 2, Processed: 1, Failed: 1}
+	if got := c.Progress(); got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+// badPage is a page that fails to convert: its front matter can't be
+// saved.
+type badPage struct {
+	txtPage
+}
+
+func (p badPage) Params() map[string]interface{} {
+	return map[string]interface{}{"mood": make(chan int)}
+}
+
+func TestConvertFileFailures(t *testing.T) {
+	const kind = "test_broken"
+	if _, ok := importer.Lookup(kind); !ok {
+		importer.Register(importer.Importer{
+			Name:        kind,
+			Description: "a backup with broken posts",
+			Detect:      func(string) bool { return false },
+			Load: func(path string) ([]importer.Page, error) {
+				d, err := goquery.NewDocumentFromReader(strings.NewReader("<p>Hello, world!</p>"))
+				if err != nil {
+					return nil, err
+				}
+				s := d.Find("body")
+				return []importer.Page{badPage{txtPage{s}}, txtPage{s.Clone()}, badPage{txtPage{s}}}, nil
+			},
+		})
+	}
+
+	c, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := c.ConvertFile("backup.txt", kind)
+	if len(bundles) != 1 {
+		t.Errorf("want 1 bundle, got %d", len(bundles))
+	}
+	var ie *ItemError
+	if !errors.As(err, &ie) || ie.Stage != StageConvert {
+		t.Errorf("want a %s failure, got %v", StageConvert, err)
+	}
+	if failures := c.Failures(); len(failures) != 2 {
+		t.Errorf("want 2 failures, got %v", failures)
+	}
+}
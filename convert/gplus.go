@@ -0,0 +1,307 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// gpAttachments is what a Google+ post has besides its text.
+type gpAttachments struct {
+	link     *gpLink
+	images   []gpImage
+	reshare  *gpReshare
+	location *gpLocation
+}
+
+type gpImage struct {
+	src, description string
+}
+
+type gpReshare struct {
+	author  gpPerson
+	url     string
+	content string
+	images  []gpImage
+}
+
+type gpLocation struct {
+	Name      string  `toml:"name,omitempty" json:"displayName"`
+	Address   string  `toml:"address,omitempty" json:"physicalAddress"`
+	Latitude  float64 `toml:"latitude,omitempty" json:"latitude"`
+	Longitude float64 `toml:"longitude,omitempty" json:"longitude"`
+	Url       string  `toml:"url,omitempty" json:"-"`
+}
+
+// html returns the attachments to put after the text of the post: the
+// reshared post as a quote, the images, and the link.
+func (a gpAttachments) html() string {
+	var b strings.Builder
+	if r := a.reshare; r != nil {
+		b.WriteString(`<blockquote class="reshare">`)
+		if r.author.DisplayName != "" {
+			b.WriteString(`<p><a href="` + html.EscapeString(r.author.ProfilePageUrl) + `">` +
+				html.EscapeString(r.author.DisplayName) + `</a>:</p>`)
+		}
+		b.WriteString(r.content)
+		b.WriteString(imagesHtml(r.images))
+		if r.url != "" {
+			b.WriteString(`<p><a href="` + html.EscapeString(r.url) + `">` + html.EscapeString(r.url) + `</a></p>`)
+		}
+		b.WriteString(`</blockquote>`)
+	}
+	b.WriteString(imagesHtml(a.images))
+	if l := a.link; l != nil && l.Url != "" {
+		t := l.Title
+		if t == "" {
+			t = l.Url
+		}
+		b.WriteString(`<p><a href="` + html.EscapeString(l.Url) + `">` + html.EscapeString(t) + `</a></p>`)
+	}
+	return b.String()
+}
+
+// imagesHtml returns the images, wrapped in an album if there are more
+// than one.
+func imagesHtml(images []gpImage) string {
+	var b strings.Builder
+	for _, i := range images {
+		b.WriteString(`<p><img src="` + html.EscapeString(i.src) + `" alt="` + html.EscapeString(i.description) + `"></p>`)
+	}
+	if len(images) > 1 {
+		return `<div class="album">` + b.String() + `</div>`
+	}
+	return b.String()
+}
+
+// params returns the front matter for the attachments.
+func (a gpAttachments) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if l := a.link; l != nil && l.Url != "" {
+		params["bookmark_of"] = l.Url
+		params["bookmark_context"] = replyContext{Url: l.Url, Name: l.Title, Photo: l.ImageUrl}
+	}
+	if r := a.reshare; r != nil && r.url != "" {
+		params["repost_of"] = r.url
+	}
+	if l := a.location; l != nil && (l.Name != "" || l.Address != "" || l.Latitude != 0 || l.Longitude != 0) {
+		params["location"] = *l
+	}
+	return params
+}
+
+// albumResources lists the album images that were saved with the post
+// as its page resources.
+func albumResources(c pageContent) []map[string]string {
+	var res []map[string]string
+	c.Find(".album img").Each(func(i int, s *goquery.Selection) {
+		src := s.AttrOr("src", "")
+		if src == "" || strings.Contains(src, ":") {
+			return
+		}
+		r := map[string]string{"src": src, "name": "album-" + strconv.Itoa(i+1)}
+		if t := s.AttrOr("alt", ""); t != "" {
+			r["title"] = t
+		}
+		res = append(res, r)
+	})
+	return res
+}
+
+// gpParams returns the front matter for the attachments and the album
+// images of the post.
+func gpParams(a gpAttachments, c pageContent) map[string]interface{} {
+	params := a.params()
+	if res := albumResources(c); len(res) > 0 {
+		params["resources"] = res
+	}
+	return params
+}
+
+type gpPage struct {
+	*goquery.Selection
+}
+
+type gpComment struct {
+	*goquery.Selection
+}
+
+func (p gpPage) canonicalUrl() string {
+	var u string
+	sel := p.Clone()
+	sel.Find(".comments").Remove()
+	sel.Find("span").Each(func(_ int, s *goquery.Selection) {
+		if at, _ := s.Attr("itemprop"); at == "dateCreated" {
+			u, _ = s.Parent().Attr("href")
+		}
+	})
+	u = string(u[strings.LastIndex(u, "/")+1:])
+	return u
+}
+
+func (p gpPage) content() pageContent {
+	s := p.Find(".main-content")
+	if _, done := s.Attr("data-attachments"); !done {
+		s.Find("br").ReplaceWithHtml("<p>")
+		s.AppendHtml(p.attachments().html())
+		s.SetAttr("data-attachments", "")
+	}
+	return pageContent{s}
+}
+
+// post returns the post itself, without the comments and reactions.
+func (p gpPage) post() *goquery.Selection {
+	sel := p.Clone()
+	sel.Find(".comments, .post-activity, .author-photo").Remove()
+	return sel
+}
+
+func (p gpPage) attachments() gpAttachments {
+	var a gpAttachments
+	post := p.post()
+	outside := func(s *goquery.Selection) bool {
+		return s.ParentsFiltered(".main-content").Length() == 0 && !s.Is(".main-content")
+	}
+
+	if l := post.Find("a.link-embed").First(); l.Length() > 0 {
+		t := strings.TrimSpace(l.Find("h3").Text())
+		if t == "" {
+			t = strings.TrimSpace(l.Text())
+		}
+		a.link = &gpLink{Title: t, Url: l.AttrOr("href", ""), ImageUrl: l.Find("img").AttrOr("src", "")}
+	}
+
+	post.Find("img").Each(func(_ int, s *goquery.Selection) {
+		if outside(s) && s.ParentsFiltered("a.link-embed, .reshare-attribution").Length() == 0 {
+			a.images = append(a.images, gpImage{s.AttrOr("src", ""), s.AttrOr("alt", "")})
+		}
+	})
+
+	if r := post.Find(".reshare-attribution").First(); r.Length() > 0 {
+		au := r.Find("a").First()
+		a.reshare = &gpReshare{
+			author: gpPerson{DisplayName: strings.TrimSpace(au.Text()), ProfilePageUrl: au.AttrOr("href", "")},
+			url:    r.Find(`a[href*="/posts/"]`).AttrOr("href", ""),
+		}
+	}
+
+	if l := post.Find("a.location, .location a").First(); l.Length() > 0 && outside(l) {
+		a.location = &gpLocation{Name: strings.TrimSpace(l.Text()), Url: l.AttrOr("href", "")}
+	}
+	return a
+}
+
+func (p gpPage) params() map[string]interface{} {
+	return gpParams(p.attachments(), p.content())
+}
+
+func (p gpPage) date() time.Time {
+	var d string
+	sel := p.Clone()
+	sel.Find(".comments").Remove()
+	sel.Find("span").Each(func(_ int, s *goquery.Selection) {
+		if at, _ := s.Attr("itemprop"); at == "dateCreated" {
+			d = s.Text()
+		}
+	})
+	dt, _ := time.Parse("2006-01-02T15:04:05-0700", d)
+	return dt
+}
+
+func (p gpPage) title() string {
+	return ""
+}
+
+func (p gpPage) tags() []string {
+	return nil
+}
+
+func (p gpPage) webmentions() []byte {
+	var mentions = struct {
+		Type     string    `json:"type"`
+		Name     string    `json:"name"`
+		Children []mention `json:"children,omitempty"`
+	}{Type: "feed", Name: "Webmentions"}
+
+	mentions.Children = append(mentions.Children, p.reactions()...)
+
+	p.Find(".comments").Find(".comment").Each(func(i int, s *goquery.Selection) {
+		cmt := gpComment{s}
+		m := getWebmention(cmt)
+		mentions.Children = append(mentions.Children, m)
+	})
+	if len(mentions.Children) > 0 {
+		b, err := json.MarshalIndent(mentions, "", " ")
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+	return nil
+}
+
+func (p gpPage) reactions() []mention {
+	var mentions []mention
+	mentions = append(mentions, p.getReactions(".resharers", "repost-of")...)
+	mentions = append(mentions, p.getReactions(".plus-oners", "like-of")...)
+	return mentions
+}
+
+func (p gpPage) getReactions(sel, typ string) []mention {
+	var mentions []mention
+	p.Find(sel).Children().Each(func(_ int, s *goquery.Selection) {
+		u, _ := s.Attr("href")
+		var a = author{Type: "card", Name: s.Text(), Url: u}
+		var m = mention{
+			Type:     "entry",
+			Property: typ,
+			Author:   a,
+		}
+		mentions = append(mentions, m)
+	})
+	return mentions
+}
+
+func (c gpComment) author() author {
+	s := c.Find(".author")
+	n := s.Text()
+	u, _ := s.Attr("href")
+	return author{Type: "card", Name: n, Url: u}
+}
+
+func (c gpComment) content() content {
+	s := c.Find(".comment-content")
+	t := s.Text()
+	h, _ := s.Html()
+	return content{Text: t, Html: h}
+}
+
+func (c gpComment) url() string {
+	return ""
+}
+
+func (c gpComment) date() string {
+	p := gpPage{c.Clone()}
+	d := p.date()
+	return d.String()
+
+}
@@ -0,0 +1,345 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const gpTimeLayout = "2006-01-02 15:04:05-0700"
+
+// gpPost is a Google+ post as the later Google Takeout archives have it.
+type gpPost struct {
+	Url          string          `json:"url"`
+	CreationTime string          `json:"creationTime"`
+	Author       gpPerson        `json:"author"`
+	Content      string          `json:"content"`
+	Link         *gpLink         `json:"link"`
+	Media        *gpMedia        `json:"media"`
+	Album        *gpAlbum        `json:"album"`
+	ResharedPost *gpPost         `json:"resharedPost"`
+	Location     *gpLocation     `json:"location"`
+	Comments     []gpJSONComment `json:"comments"`
+	PlusOnes     []struct {
+		PlusOner gpPerson `json:"plusOner"`
+	} `json:"plusOnes"`
+	Reshares []struct {
+		Resharer gpPerson `json:"resharer"`
+	} `json:"reshares"`
+	PostAcl gpAcl `json:"postAcl"`
+}
+
+type gpPerson struct {
+	DisplayName    string `json:"displayName"`
+	ProfilePageUrl string `json:"profilePageUrl"`
+	AvatarImageUrl string `json:"avatarImageUrl"`
+}
+
+type gpLink struct {
+	Title    string `json:"title"`
+	Url      string `json:"url"`
+	ImageUrl string `json:"imageUrl"`
+}
+
+type gpMedia struct {
+	Url           string `json:"url"`
+	ContentType   string `json:"contentType"`
+	Description   string `json:"description"`
+	LocalFilePath string `json:"localFilePath"`
+}
+
+type gpAlbum struct {
+	Media []gpMedia `json:"media"`
+}
+
+type gpAcl struct {
+	VisibleToStandardAcl *struct {
+		Circles []struct {
+			Type string `json:"type"`
+		} `json:"circles"`
+	} `json:"visibleToStandardAcl"`
+	CollectionAcl *struct {
+		Collection struct {
+			DisplayName string `json:"displayName"`
+		} `json:"collection"`
+	} `json:"collectionAcl"`
+	CommunityAcl *struct {
+		Community struct {
+			DisplayName string `json:"displayName"`
+		} `json:"community"`
+	} `json:"communityAcl"`
+}
+
+type gpJSONComment struct {
+	CreationTime string   `json:"creationTime"`
+	Author       gpPerson `json:"author"`
+	Content      string   `json:"content"`
+}
+
+// gpJSONPage is a Google+ post from a JSON Takeout archive; the media
+// are looked up next to the JSON file. The ones found are copied by
+// their links in local, and the media other than images are saved with
+// the post under their names in assets.
+type gpJSONPage struct {
+	post   gpPost
+	dir    string
+	sel    *goquery.Selection
+	local  map[string]string
+	assets map[string]string
+}
+
+func loadGpJSON(path string) (gpJSONPage, error) {
+	var p gpJSONPage
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p.post); err != nil {
+		return p, err
+	}
+	if p.post.Url == "" || p.post.CreationTime == "" {
+		return p, fmt.Errorf("not a Google+ post")
+	}
+	p.dir = filepath.Dir(path)
+	p.local, p.assets = map[string]string{}, map[string]string{}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(p.html()))
+	if err != nil {
+		return p, err
+	}
+	p.sel = doc.Find("body")
+	p.sel.Find("br").ReplaceWithHtml("<p>")
+	return p, nil
+}
+
+func (p gpJSONPage) html() string {
+	var b strings.Builder
+	b.WriteString(p.post.Content)
+	for i, m := range p.post.media() {
+		if isImage(m) {
+			continue
+		}
+		src := p.mediaSrc(m)
+		if fn, ok := p.local[src]; ok {
+			name := strconv.Itoa(i) + filepath.Base(fn)
+			p.assets[name] = src
+			src = name
+		}
+		text := m.Description
+		if text == "" {
+			text = src
+		}
+		b.WriteString(`<p><a href="` + html.EscapeString(src) + `">` + html.EscapeString(text) + `</a></p>`)
+	}
+	b.WriteString(p.attachments().html())
+	return b.String()
+}
+
+func (p gpJSONPage) attachments() gpAttachments {
+	a := gpAttachments{link: p.post.Link, location: p.post.Location, images: p.images(p.post)}
+	if r := p.post.ResharedPost; r != nil {
+		a.reshare = &gpReshare{author: r.Author, url: r.Url, content: r.Content, images: p.images(*r)}
+		if a.link == nil {
+			a.link = r.Link
+		}
+	}
+	return a
+}
+
+// media returns the single media of the post and the ones in its album.
+func (post gpPost) media() []gpMedia {
+	var media []gpMedia
+	if post.Media != nil {
+		media = append(media, *post.Media)
+	}
+	if post.Album != nil {
+		media = append(media, post.Album.Media...)
+	}
+	return media
+}
+
+func (p gpJSONPage) images(post gpPost) []gpImage {
+	var images []gpImage
+	for _, m := range post.media() {
+		if isImage(m) {
+			images = append(images, gpImage{p.mediaSrc(m), m.Description})
+		}
+	}
+	return images
+}
+
+func isImage(m gpMedia) bool {
+	return strings.HasPrefix(m.ContentType, "image/")
+}
+
+// mediaSrc returns the link to the media: its URL, or its path in the
+// archive if it has none. The local copy of the media, if the archive
+// has one inside its directory, is added to the local files by the link.
+func (p gpJSONPage) mediaSrc(m gpMedia) string {
+	link := m.Url
+	if link == "" {
+		link = filepath.ToSlash(m.LocalFilePath)
+	}
+	candidates := []string{m.LocalFilePath, filepath.Base(m.LocalFilePath)}
+	if u, err := url.Parse(m.Url); err == nil {
+		candidates = append(candidates, path.Base(u.Path))
+	}
+	for _, c := range candidates {
+		if c == "" || c == "." || c == "/" || link == "" {
+			continue
+		}
+		if fn, ok := archiveFile(p.dir, c); ok {
+			p.local[link] = fn
+			break
+		}
+	}
+	return link
+}
+
+func (p gpJSONPage) files() map[string]string {
+	return p.assets
+}
+
+func (p gpJSONPage) localFiles() map[string]string {
+	return p.local
+}
+
+func (p gpJSONPage) canonicalUrl() string {
+	u := p.post.Url
+	return u[strings.LastIndex(u, "/")+1:]
+}
+
+func (p gpJSONPage) content() pageContent {
+	return pageContent{p.sel}
+}
+
+func (p gpJSONPage) date() time.Time {
+	dt, _ := time.Parse(gpTimeLayout, p.post.CreationTime)
+	return dt
+}
+
+func (p gpJSONPage) title() string {
+	return ""
+}
+
+func (p gpJSONPage) tags() []string {
+	return nil
+}
+
+// access returns the visibility of the post, or an empty string if the
+// post is public.
+func (p gpJSONPage) access() string {
+	acl := p.post.PostAcl.VisibleToStandardAcl
+	if acl == nil {
+		return ""
+	}
+	access := "private"
+	for _, c := range acl.Circles {
+		switch c.Type {
+		case "CIRCLE_TYPE_PUBLIC":
+			return ""
+		case "CIRCLE_TYPE_EXTENDED_CIRCLES":
+			access = "extended-circles"
+		case "CIRCLE_TYPE_YOUR_CIRCLES":
+			if access == "private" {
+				access = "circles"
+			}
+		}
+	}
+	return access
+}
+
+func (p gpJSONPage) params() map[string]interface{} {
+	params := gpParams(p.attachments(), p.content())
+	if c := p.post.PostAcl.CollectionAcl; c != nil && c.Collection.DisplayName != "" {
+		params["collection"] = c.Collection.DisplayName
+	}
+	if c := p.post.PostAcl.CommunityAcl; c != nil && c.Community.DisplayName != "" {
+		params["community"] = c.Community.DisplayName
+	}
+	if a := p.access(); a != "" {
+		params["access"] = a
+		params["draft"] = true
+	}
+	return params
+}
+
+func (p gpJSONPage) webmentions() []byte {
+	var mentions = struct {
+		Type     string    `json:"type"`
+		Name     string    `json:"name"`
+		Children []mention `json:"children,omitempty"`
+	}{Type: "feed", Name: "Webmentions"}
+
+	for _, r := range p.post.Reshares {
+		mentions.Children = append(mentions.Children, gpReaction(r.Resharer, "repost-of"))
+	}
+	for _, r := range p.post.PlusOnes {
+		mentions.Children = append(mentions.Children, gpReaction(r.PlusOner, "like-of"))
+	}
+	for _, c := range p.post.Comments {
+		m := getWebmention(c)
+		mentions.Children = append(mentions.Children, m)
+	}
+	if len(mentions.Children) > 0 {
+		b, err := json.MarshalIndent(mentions, "", " ")
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+	return nil
+}
+
+func gpReaction(a gpPerson, typ string) mention {
+	return mention{
+		Type:     "entry",
+		Property: typ,
+		Author:   author{Type: "card", Name: a.DisplayName, Url: a.ProfilePageUrl},
+	}
+}
+
+func (c gpJSONComment) author() author {
+	return author{Type: "card", Name: c.Author.DisplayName, Url: c.Author.ProfilePageUrl, Photo: c.Author.AvatarImageUrl}
+}
+
+func (c gpJSONComment) content() content {
+	var t string
+	if d, err := goquery.NewDocumentFromReader(strings.NewReader(c.Content)); err == nil {
+		t = d.Text()
+	}
+	return content{Text: t, Html: c.Content}
+}
+
+func (c gpJSONComment) url() string {
+	return ""
+}
+
+func (c gpJSONComment) date() string {
+	d, _ := time.Parse(gpTimeLayout, c.CreationTime)
+	return d.String()
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGpJSON(t *testing.T) {
+	p, err := loadGpJSON(filepath.Join("testdata", "gp_takeout.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "Hx4mLbV3Rz8", p.canonicalUrl())
+
+	abs, err := filepath.Abs(filepath.Join("testdata", "gp_takeout.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnt := p.content()
+	images := cnt.processImages()
+	if len(images) != 1 || p.localFiles()[images["image0"]] != abs {
+		t.Fatalf("want the image from the archive, got %v", images)
+	}
+
+	_, got := mustHugo(t, testConverter(t), p)
+	assertGolden(t, got, filepath.Join("testdata", "gp_takeout.md"))
+	assertGolden(t, p.webmentions(), filepath.Join("testdata", "gp_takeout_wm.json"))
+}
+
+func TestGpJSONReshare(t *testing.T) {
+	p, err := loadGpJSON(filepath.Join("testdata", "gp_reshare.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnt := p.content()
+	images := cnt.processImages()
+	if len(images) != 2 {
+		t.Fatalf("want both album images, got %v", images)
+	}
+
+	_, got := mustHugo(t, testConverter(t), p)
+	assertGolden(t, got, filepath.Join("testdata", "gp_reshare.md"))
+}
+
+func TestGpJSONNotAPost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "activity.json")
+	if err := ioutil.WriteFile(fn, []byte(`{"items": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadGpJSON(fn); err == nil {
+		t.Fatal("want an error")
+	}
+}
+
+func TestCopyFromArchive(t *testing.T) {
+	src, err := filepath.Abs(filepath.Join("testdata", "gp_takeout.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := map[string]string{"image0": "gp_takeout.jpg", "image1": "file://" + src}
+	files, errs := testConverter(t).fetchImages(images, map[string]string{"gp_takeout.jpg": src})
+	if len(errs) != 1 {
+		t.Fatalf("want the file:// link not fetched, got %v", errs)
+	}
+	if _, ok := files["image1"]; ok {
+		t.Fatal("want no file fetched by the file:// link")
+	}
+
+	want, _ := ioutil.ReadFile(src)
+	got := files["image0"]
+	if !bytes.Equal(want, got) {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestGpJSONMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "Takeout", "Posts")
+	if err := os.MkdirAll(archive, 0755); err != nil {
+		t.Fatal(err)
+	}
+	post := `{
+  "url": "https://plus.google.com/+EvgenyKuznetsov/posts/Vd5kLm2Np7q",
+  "creationTime": "2018-03-12 09:58:53+0000",
+  "content": "Весна!",
+  "media": {"url": "https://video.googleusercontent.com/clip.mp4", "contentType": "video/mp4", "localFilePath": "clip.mp4"},
+  "album": {"media": [{"contentType": "image/*", "localFilePath": "../../secret.jpg"}]}
+}`
+	files := map[string]string{
+		filepath.Join(archive, "post.json"): post,
+		filepath.Join(archive, "clip.mp4"):  "video",
+		filepath.Join(dir, "secret.jpg"):    "secret",
+	}
+	for fn, s := range files {
+		if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundles, err := testConverter(t).ConvertFile(filepath.Join(archive, "post.json"), "gplus")
+	if len(bundles) != 1 {
+		t.Fatalf("want 1 bundle, got %d (%v)", len(bundles), err)
+	}
+	b := bundles[0]
+	md := string(b.Files["index.md"])
+	if !strings.Contains(md, "[0clip.mp4](0clip.mp4)") || strings.Contains(md, "file://") || strings.Contains(md, dir) {
+		t.Errorf("want the video linked in the bundle, got:\n%s", md)
+	}
+	assertString(t, "video", string(b.Files["0clip.mp4"]))
+	if _, ok := b.Files["image0"]; ok || !strings.Contains(md, "../../secret.jpg") {
+		t.Errorf("want the file outside the archive not copied, got:\n%s", md)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// hashtagRe matches a hashtag that has at least one letter in it, so
+// that "#1" is not a tag.
+var hashtagRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+
+// hashtags returns the hashtags found in the text of the content, in
+// the order they appear and without duplicates.
+func hashtags(c pageContent) []string {
+	var tags []string
+	for _, n := range c.Nodes {
+		walkText(n, true, func(t *html.Node) {
+			for _, m := range hashtagRe.FindAllStringSubmatch(t.Data, -1) {
+				tags = mergeTags(tags, []string{m[1]})
+			}
+		})
+	}
+	return tags
+}
+
+// linkHashtags turns the hashtags in the text of the content into links
+// to the tag pages under base.
+func linkHashtags(c pageContent, base string) {
+	var texts []*html.Node
+	for _, n := range c.Nodes {
+		walkText(n, false, func(t *html.Node) {
+			if hashtagRe.MatchString(t.Data) {
+				texts = append(texts, t)
+			}
+		})
+	}
+	for _, t := range texts {
+		s := t.Data
+		last := 0
+		for _, m := range hashtagRe.FindAllStringSubmatchIndex(s, -1) {
+			start := m[2] - 1
+			tag := s[m[2]:m[3]]
+			insertText(t, s[last:start])
+			a := &html.Node{
+				Type: html.ElementNode,
+				Data: "a",
+				Attr: []html.Attribute{{Key: "href", Val: tagURL(base, tag)}},
+			}
+			a.AppendChild(&html.Node{Type: html.TextNode, Data: "#" + tag})
+			t.Parent.InsertBefore(a, t)
+			last = m[3]
+		}
+		t.Data = s[last:]
+	}
+}
+
+func tagURL(base, tag string) string {
+	return strings.TrimSuffix(base, "/") + "/" + url.PathEscape(strings.ToLower(tag)) + "/"
+}
+
+func insertText(before *html.Node, s string) {
+	if s == "" {
+		return
+	}
+	before.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: s}, before)
+}
+
+// walkText calls f for every text node that is not code, and not a link
+// unless inLinks is set.
+func walkText(n *html.Node, inLinks bool, f func(*html.Node)) {
+	if n.Type == html.TextNode {
+		f(n)
+		return
+	}
+	if n.Type == html.ElementNode {
+		switch n.Data {
+		case "code", "pre", "script", "style":
+			return
+		case "a":
+			if !inLinks {
+				return
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkText(c, inLinks, f)
+	}
+}
+
+// mergeTags adds the tags that are not there yet, ignoring the case.
+func mergeTags(tags, more []string) []string {
+	for _, m := range more {
+		found := false
+		for _, t := range tags {
+			if strings.EqualFold(t, m) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tags = append(tags, m)
+		}
+	}
+	return tags
+}
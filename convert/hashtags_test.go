@@ -0,0 +1,76 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want []string
+	}{
+		"latin":    {`<p>Hello #world and #Go_lang!</p>`, []string{"world", "Go_lang"}},
+		"cyrillic": {`<p>#привет, #Мир2020 и #мир2020</p>`, []string{"привет", "Мир2020"}},
+		"numbers":  {`<p>Issue #1 and &#35;2</p>`, nil},
+		"not tags": {`<p>a#b, <a href="/#anchor">link</a>, <code>#define</code></p>`, nil},
+		"in link":  {`<p><a href="/tags/go/">#go</a></p>`, []string{"go"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := hashtags(loadContent(t, tc.html))
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLinkHashtags(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want string
+	}{
+		"latin":    {`<p>Hello #world!</p>`, `<p>Hello <a href="/tags/world/">#world</a>!</p>`},
+		"cyrillic": {`<p>#Привет, мир</p>`, `<p><a href="/tags/%D0%BF%D1%80%D0%B8%D0%B2%D0%B5%D1%82/">#Привет</a>, мир</p>`},
+		"two":      {`<p>#a #b</p>`, `<p><a href="/tags/a/">#a</a> <a href="/tags/b/">#b</a></p>`},
+		"link":     {`<p><a href="/">#a</a></p>`, `<p><a href="/">#a</a></p>`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := loadContent(t, tc.html)
+			linkHashtags(c, "/tags")
+			got, _ := c.Html()
+			assertString(t, tc.want, got)
+		})
+	}
+}
+
+func loadContent(t *testing.T, s string) pageContent {
+	t.Helper()
+	d, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pageContent{d.Find("body")}
+}
@@ -0,0 +1,562 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+type page interface {
+	title() string
+	date() time.Time
+	content() pageContent
+	canonicalUrl() string
+	tags() []string
+	webmentions() []byte
+}
+
+const (
+	formatMarkdown = "md"
+	formatHTML     = "html"
+	formatHybrid   = "hybrid"
+)
+
+// lossyElements are the ones markdown has no way to represent.
+const lossyElements = "table, center, u, sub, sup, font[color], font[face], font[size], " +
+	"[bgcolor], object, embed, video, audio, svg, canvas, map, form"
+
+// lossyStyles are the CSS properties that change the looks of the text
+// rather than just the layout.
+var lossyStyles = []string{"color", "background", "font", "text-align", "text-decoration", "float", "border"}
+
+// paramsPage is a page that has more to put into the front matter.
+type paramsPage interface {
+	params() map[string]interface{}
+}
+
+// checkFormat tells whether the output format is one known-to-hugo has;
+// markdown is the default.
+func checkFormat(format string) error {
+	switch format {
+	case "", formatMarkdown, formatHTML, formatHybrid:
+		return nil
+	}
+	return fmt.Errorf("%s: unknown output format", format)
+}
+
+// pageTags returns the tags of the page, along with its hashtags if
+// asked to.
+func (c *Converter) pageTags(p page) []string {
+	tags := p.tags()
+	if c.opts.Hashtags {
+		tags = mergeTags(tags, hashtags(p.content()))
+	}
+	return tags
+}
+
+// pageParams returns the extra front matter of the page, if any.
+func pageParams(p page) map[string]interface{} {
+	params := map[string]interface{}{}
+	if pp, ok := p.(paramsPage); ok {
+		for k, v := range pp.params() {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// filesPage is a page that has more files to save along with it, like
+// the userpic of a LiveJournal entry.
+type filesPage interface {
+	files() map[string]string
+}
+
+// pageFiles returns the files to save with the page, by the URLs to get
+// them from.
+func pageFiles(p page) map[string]string {
+	if fp, ok := p.(filesPage); ok {
+		return fp.files()
+	}
+	return nil
+}
+
+// localPage is a page of a local backup that has files saved along with
+// it, like the images of a LiveJournal backup or the media of a Google+
+// Takeout archive.
+type localPage interface {
+	// localFiles returns the paths of the files inside the backup, by the
+	// links to them the page has.
+	localFiles() map[string]string
+}
+
+// pageLocalFiles returns the files of the backup to copy rather than
+// download, by the links to them.
+func pageLocalFiles(p page) map[string]string {
+	if lp, ok := p.(localPage); ok {
+		return lp.localFiles()
+	}
+	return nil
+}
+
+type pageContent struct {
+	*goquery.Selection
+}
+
+type comment interface {
+	author() author
+	content() content
+	url() string
+	date() string
+}
+
+// blogDir converts the posts in the directory and saves them to the
+// output directory, returning the failures.
+func (c *Converter) blogDir(input, output string, imp importer.Importer) []*ItemError {
+	var errs []*ItemError
+	_ = filepath.Walk(input, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			failed := []*ItemError{itemError(path, StageLoad, err)}
+			c.logFailures(failed)
+			errs = append(errs, failed...)
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		c.log.Debug("reading", "file", path)
+		bundles, failed := c.importBundles(path, imp)
+		for _, b := range bundles {
+			if err := b.Write(output); err != nil {
+				failed = append(failed, itemError(path, StageWrite, fmt.Errorf("%s: %w", b.Path, err)))
+				continue
+			}
+			atomic.AddInt64(&c.stats.Processed, 1)
+		}
+		c.logFailures(failed)
+		errs = append(errs, failed...)
+		return nil
+	})
+	return errs
+}
+
+// importBundles makes the bundles of the posts the importer finds in the
+// file. The posts that fail are left out, and so are their errors.
+func (c *Converter) importBundles(path string, imp importer.Importer) ([]*Bundle, []*ItemError) {
+	pages, err := c.importPages(path, imp)
+	if err != nil {
+		atomic.AddInt64(&c.stats.Discovered, 1)
+		return nil, []*ItemError{itemError(path, StageLoad, err)}
+	}
+	atomic.AddInt64(&c.stats.Discovered, int64(len(pages)))
+	var (
+		bundles []*Bundle
+		errs    []*ItemError
+	)
+	for _, p := range pages {
+		url := p.canonicalUrl()
+		b, err := c.pageBundle(p, strings.TrimSuffix(url, filepath.Ext(url)))
+		if err != nil {
+			errs = append(errs, itemError(path, StageConvert, fmt.Errorf("%s: %w", url, err)))
+			continue
+		}
+		errs = append(errs, assetErrors(path, b)...)
+		bundles = append(bundles, b)
+	}
+	return bundles, errs
+}
+
+// pageBundle makes the bundle of the page and its comments.
+func (c *Converter) pageBundle(p page, orig string) (*Bundle, error) {
+	p, slug := c.withTitle(p, orig)
+	p, slug = c.withSlug(p, orig, slug)
+
+	cnt := p.content()
+	images := cnt.processImages()
+	for fn, u := range pageFiles(p) {
+		images[fn] = u
+	}
+	files, errs := c.fetchImages(images, pageLocalFiles(p))
+	for fn, u := range images {
+		if _, ok := files[fn]; !ok {
+			cnt.restoreLink(fn, u)
+		}
+	}
+	b := &Bundle{
+		Path:        path.Join(strconv.Itoa(p.date().Year()), slug),
+		Files:       files,
+		AssetErrors: errs,
+	}
+
+	name, content, err := c.hugo(p)
+	if err != nil {
+		return nil, err
+	}
+	b.Files[name] = content
+
+	if wm := p.webmentions(); len(wm) > 0 {
+		b.Files["webmentions.json"] = wm
+	}
+	return b, nil
+}
+
+// loadPages loads the pages of the blog type from the file; most files
+// have one page at most, but an XML export may have many. The HTML
+// backups have other pages besides the posts, so only the ones that are
+// saved under their own names count.
+func (c *Converter) loadPages(path, blogType string) ([]page, error) {
+	if blogType == "ljxml" {
+		return c.loadLJXML(path)
+	}
+
+	p, err := c.loadPage(path, blogType)
+	if p == nil || err != nil {
+		return nil, err
+	}
+	if url := p.canonicalUrl(); blogType != "gplus" && (url == "" || url != filepath.Base(path)) {
+		return nil, nil
+	}
+	return []page{p}, nil
+}
+
+// loadPage loads the file as a page of the blog type, returning nil if
+// the file is not a page at all.
+func (c *Converter) loadPage(path, blogType string) (page, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if blogType == "gplus" {
+		switch ext {
+		case ".json":
+			return loadGpJSON(path)
+		case ".html", ".htm":
+		default:
+			// the media files of the Takeout archive
+			return nil, nil
+		}
+	}
+
+	s, err := loadHtmlFile(path, c.charset)
+	if err != nil {
+		return nil, err
+	}
+	return c.htmlPage(s, blogType, path)
+}
+
+// htmlPage returns the HTML page of the blog type, or nil if it's to be
+// skipped. The images of the LiveJournal backups are looked up next to
+// the file the page is from, if it's known.
+func (c *Converter) htmlPage(s *goquery.Selection, blogType, path string) (page, error) {
+	switch blogType {
+	case "diary":
+		return diaryPage{s}, nil
+	case "ljbackup":
+		p := newLJBPage(s, c.ljOptions())
+		if path != "" {
+			p.local = localImages(s, filepath.Dir(path))
+		}
+		if sec := p.security(); p.opts.securityPolicy(sec) == policySkip {
+			c.log.Info("skipping entry", "file", path, "security", sec)
+			return nil, nil
+		}
+		return p, nil
+	case "gplus":
+		return gpPage{s}, nil
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+// hugo returns the name of the content file of the page and its
+// contents, the front matter and the body.
+func (c *Converter) hugo(p page) (string, []byte, error) {
+	b, err := c.getFM(p)
+	if err != nil {
+		return "", nil, err
+	}
+	ct := p.content()
+	if c.opts.Hashtags && c.opts.HashtagBase != "" {
+		linkHashtags(ct, c.opts.HashtagBase)
+	}
+	name, body := ct.render(c.opts.Format, c.opts.Embeds)
+	if c.opts.Lang == langFile {
+		name = langFileName(name, pageLang(ct))
+	}
+	b = append(b, body...)
+	return name, b, nil
+}
+
+func (c *Converter) getFM(p page) ([]byte, error) {
+	var frontMatter = map[string]interface{}{
+		"title": p.title(),
+		"date":  p.date(),
+		"tags":  c.pageTags(p),
+		//		"reply_to":       getInReply(sel),
+		//		"posse":          getSyndications(sel),
+		//		"like_of":        getLikeOf(sel),
+		"draft": c.opts.Draft,
+	}
+	if c.opts.Lang == langKey {
+		if l := pageLang(p.content()); l != "" {
+			frontMatter["lang"] = l
+		}
+	}
+	if c.opts.Summaries {
+		t, cut := leadText(p.content())
+		addSummary(frontMatter, t, cut)
+	}
+	for k, v := range pageParams(p) {
+		frontMatter[k] = v
+	}
+	if c.opts.ReplyContexts {
+		if rc := c.contexts.get(replyTargets(frontMatter)...); len(rc) > 0 {
+			frontMatter["reply_context"] = rc
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(frontMatter); err != nil {
+		return nil, fmt.Errorf("front matter: %w", err)
+	}
+	var b []byte
+	b = append(b, []byte(frontMatterSeparator)...)
+	b = append(b, buf.Bytes()...)
+	b = append(b, []byte(frontMatterSeparator)...)
+	return b, nil
+}
+
+// replyTargets returns the URLs the post replies to, likes or reposts.
+func replyTargets(fm map[string]interface{}) []string {
+	urls, _ := fm["reply_to"].([]string)
+	for _, k := range []string{"like_of", "repost_of"} {
+		if u, ok := fm[k].(string); ok {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// md returns the content as markdown, with the embeds listed converted
+// to Hugo shortcodes.
+func (c *pageContent) md(embeds string) []byte {
+	converter := newConverter(embeds)
+	got := converter.Convert(c.Unwrap())
+	return []byte(cleanMarkdown(got))
+}
+
+// render returns the name of the content file to write and its contents
+// in the chosen output format.
+func (c *pageContent) render(format, embeds string) (string, []byte) {
+	switch {
+	case format == formatHTML:
+		return "index.html", c.html()
+	case format == formatHybrid && c.lossy(embeds):
+		return "index.html", c.html()
+	default:
+		return "index.md", c.md(embeds)
+	}
+}
+
+func (c *pageContent) html() []byte {
+	h, _ := c.Clone().Find("script").Remove().End().Html()
+	return []byte(strings.TrimSpace(h) + "\n")
+}
+
+// lossy tells whether converting the content to markdown would lose
+// some of its formatting; the embeds listed are converted to shortcodes
+// rather than lost.
+func (c *pageContent) lossy(embeds string) bool {
+	lost := c.Find(lossyElements).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.TrimSpace(s.Text()) != "" || s.Find("img").Length() > 0 || !s.Is("table")
+	}).Length() > 0
+	c.Find("[style], [align]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if a := strings.ToLower(s.AttrOr("align", "")); a == "center" || a == "right" || a == "justify" {
+			lost = true
+		}
+		for _, d := range strings.Split(s.AttrOr("style", ""), ";") {
+			prop := strings.ToLower(strings.TrimSpace(strings.SplitN(d, ":", 2)[0]))
+			for _, l := range lossyStyles {
+				if strings.HasPrefix(prop, l) {
+					lost = true
+				}
+			}
+		}
+		return !lost
+	})
+	if lost {
+		return true
+	}
+	c.Find("iframe").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		src := s.AttrOr("src", "")
+		if !(youtube(src) != "" && embedEnabled(embeds, "youtube")) && !(vimeo(src) != "" && embedEnabled(embeds, "vimeo")) {
+			lost = true
+		}
+		return !lost
+	})
+	return lost
+}
+
+func (c *pageContent) processImages() map[string]string {
+	se := c.Unwrap()
+	out := map[string]string{}
+	se.Find("img").Each(func(i int, s *goquery.Selection) {
+		if s.HasClass("ljuser-icon") {
+			return
+		}
+		link, _ := s.Attr("src")
+		fn := imageName(i)
+
+		// fix hrefs
+		changeHrefs(se, link, fn)
+		s.SetAttr("src", fn)
+
+		out[fn] = link
+	})
+	return out
+}
+
+// restoreLink puts the URL of the file that couldn't be saved with the
+// bundle back into the content.
+func (c pageContent) restoreLink(fn, link string) {
+	c.Find("img").Each(func(_ int, s *goquery.Selection) {
+		if s.AttrOr("src", "") == fn {
+			s.SetAttr("src", link)
+		}
+	})
+	changeHrefs(c.Selection, fn, link)
+}
+
+// imageName returns the name the image of the content is saved under.
+func imageName(i int) string {
+	return "image" + strconv.Itoa(i)
+}
+
+func getWebmention(cmt comment) mention {
+	var m = mention{
+		Type:   "entry",
+		Author: cmt.author(),
+	}
+	m.Content = cmt.content()
+	m.Property = "in-reply-to"
+	m.Url = cmt.url()
+	m.Date = cmt.date()
+	return m
+}
+
+// localImages returns the paths of the images that are saved along with
+// the page in the directory, by their links, so that they are copied
+// rather than downloaded.
+func localImages(sel *goquery.Selection, dir string) map[string]string {
+	local := map[string]string{}
+	sel.Find("img").Each(func(_ int, s *goquery.Selection) {
+		src := s.AttrOr("src", "")
+		if src == "" || strings.Contains(src, ":") {
+			return
+		}
+		if fn, ok := archiveFile(dir, filepath.FromSlash(src)); ok {
+			local[src] = fn
+		}
+	})
+	return local
+}
+
+// archiveFile returns the absolute path of the file at the path relative
+// to the directory of the backup, if there is such a file and it's
+// inside the directory.
+func archiveFile(dir, name string) (string, bool) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", false
+	}
+	fn, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, fn)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if info, err := os.Stat(fn); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return fn, true
+}
+
+// loadHtmlFile loads the page from the file; see parseHtml.
+func loadHtmlFile(path string, charset encoding.Encoding) (*goquery.Selection, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseHtml(b, charset)
+}
+
+// parseHtml parses the page in the charset, if it's set, or in whatever
+// encoding it is.
+func parseHtml(b []byte, charset encoding.Encoding) (*goquery.Selection, error) {
+	enc, b := detectEncoding(b, charset)
+	var r io.Reader = bytes.NewReader(b)
+	if n, _ := htmlindex.Name(enc); n != "utf-8" {
+		r = enc.NewDecoder().Reader(r)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Find("html"), nil
+}
+
+func getEncoding(s *goquery.Selection) encoding.Encoding {
+	var e encoding.Encoding
+	s.Find("head").Find("meta").Each(func(i int, s *goquery.Selection) {
+		if charset, ok := s.Attr("charset"); ok {
+			enc, err := htmlindex.Get(charset)
+			if err != nil {
+				return
+			}
+			e = enc
+		}
+		if he, ok := s.Attr("http-equiv"); ok && strings.EqualFold(strings.TrimSpace(he), "content-type") {
+			if con, ok := s.Attr("content"); ok {
+				enc, err := htmlindex.Get(metaCharset(con))
+				if err != nil {
+					return
+				}
+				e = enc
+			}
+		}
+	})
+	return e
+}
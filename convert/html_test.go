@@ -13,9 +13,10 @@
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 
-package main
+package convert
 
 import (
+	"bytes"
 	"path/filepath"
 	"testing"
 
@@ -30,15 +31,18 @@ func TestHugo(t *testing.T) {
 	}{
 		"diary_comments": {"diary_comments.htm", "diary", "diary_comments.md"},
 		"diary_pic":      {"diary_pic.htm", "diary", "diary_pic.md"},
+		"diary_markup":   {"diary_markup.htm", "diary", "diary_markup.md"},
 		"ljbackup":       {"ljbackup.html", "ljbackup", "ljbackup.md"},
 		"ljb_formatting": {"ljb_f.html", "ljbackup", "ljb_f.md"},
+		"ljb_markup":     {"ljb_markup.html", "ljbackup", "ljb_markup.md"},
 		"gp_likes":       {"gp1.html", "gplus", "gp1.md"},
 		"gp_comment":     {"gp2.html", "gplus", "gp2.md"},
+		"gp_link":        {"gp3.html", "gplus", "gp3.md"},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			s, err := loadHtmlFile(filepath.Join("testdata", tc.file))
+			s, err := loadHtmlFile(filepath.Join("testdata", tc.file), nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -47,14 +51,14 @@ func TestHugo(t *testing.T) {
 			case "diary":
 				p = diaryPage{s}
 			case "ljbackup":
-				p = ljbPage{s}
+				p = newLJBPage(s, ljOptions{})
 			case "gplus":
 				p = gpPage{s}
 			default:
 				t.Fatal("not implemented")
 			}
 			g := filepath.Join("testdata", tc.want)
-			got := hugo(p, false)
+			_, got := mustHugo(t, testConverter(t), p)
 			assertGolden(t, got, g)
 		})
 	}
@@ -76,7 +80,7 @@ func TestCanonicalUrl(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			s, err := loadHtmlFile(filepath.Join("testdata", tc.file))
+			s, err := loadHtmlFile(filepath.Join("testdata", tc.file), nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -85,7 +89,7 @@ func TestCanonicalUrl(t *testing.T) {
 			case "diary":
 				p = diaryPage{s}
 			case "ljbackup":
-				p = ljbPage{s}
+				p = newLJBPage(s, ljOptions{})
 			case "gplus":
 				p = gpPage{s}
 			default:
@@ -111,7 +115,7 @@ func TestProcessImages(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			s, err := loadHtmlFile(filepath.Join("testdata", tc.file))
+			s, err := loadHtmlFile(filepath.Join("testdata", tc.file), nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -120,7 +124,7 @@ func TestProcessImages(t *testing.T) {
 			case "diary":
 				p = diaryPage{s}
 			case "ljbackup":
-				p = ljbPage{s}
+				p = newLJBPage(s, ljOptions{})
 			default:
 				t.Fatal("not implemented")
 			}
@@ -155,7 +159,7 @@ func TestWebmentions(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			s, err := loadHtmlFile(filepath.Join("testdata", tc.file))
+			s, err := loadHtmlFile(filepath.Join("testdata", tc.file), nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -164,7 +168,7 @@ func TestWebmentions(t *testing.T) {
 			case "diary":
 				p = diaryPage{s}
 			case "ljbackup":
-				p = ljbPage{s}
+				p = newLJBPage(s, ljOptions{})
 			case "gplus":
 				p = gpPage{s}
 			default:
@@ -177,6 +181,45 @@ func TestWebmentions(t *testing.T) {
 	}
 }
 
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		file      string
+		processor string
+		format    string
+		want      string
+	}{
+		"md":               {"ljb_f.html", "ljbackup", formatMarkdown, "index.md"},
+		"html":             {"ljbackup.html", "ljbackup", formatHTML, "index.html"},
+		"hybrid_lossy":     {"ljb_f.html", "ljbackup", formatHybrid, "index.html"},
+		"hybrid_lossless":  {"ljbackup.html", "ljbackup", formatHybrid, "index.md"},
+		"hybrid_diary_pic": {"diary_pic.htm", "diary", formatHybrid, "index.md"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := loadHtmlFile(filepath.Join("testdata", tc.file), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p page
+			switch tc.processor {
+			case "diary":
+				p = diaryPage{s}
+			case "ljbackup":
+				p = newLJBPage(s, ljOptions{})
+			default:
+				t.Fatal("not implemented")
+			}
+			c := testConverter(t, func(o *Options) { o.Format = tc.format })
+			got, b := mustHugo(t, c, p)
+			assertString(t, tc.want, got)
+			if !bytes.HasPrefix(b, []byte(frontMatterSeparator)) {
+				t.Fatalf("no front matter in:\n%s", b)
+			}
+		})
+	}
+}
+
 func TestGetEncoding(t *testing.T) {
 	tests := map[string]struct {
 		file string
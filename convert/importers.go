@@ -0,0 +1,183 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+func init() {
+	importer.Register(importer.Importer{
+		Name:        "diary.ru",
+		Description: "diary.ru backup",
+		Detect: htmlDetector(func(s *goquery.Selection) bool {
+			return s.Find(".singlePost .urlLink a").Length() > 0
+		}),
+		Load: localLoader("diary"),
+	})
+	importer.Register(importer.Importer{
+		Name:        "lj_backup",
+		Description: "LiveJournal HTML backup",
+		Detect: htmlDetector(func(s *goquery.Selection) bool {
+			return s.Find(`.lesstop a[href*="livejournal.com"]`).Length() > 0
+		}),
+		Load: localLoader("ljbackup"),
+	})
+	importer.Register(importer.Importer{
+		Name:        "lj_xml",
+		Description: "LiveJournal XML archive by ljdump or the XML export",
+		Detect: func(path string) bool {
+			root, _, _ := readLJXML(path)
+			return root == "event" || root == "livejournal"
+		},
+		Load: localLoader("ljxml"),
+	})
+	importer.Register(importer.Importer{
+		Name:        "gplus",
+		Description: "Google+ Takeout archive, HTML or JSON",
+		Detect: func(path string) bool {
+			if strings.ToLower(filepath.Ext(path)) == ".json" {
+				_, err := loadGpJSON(path)
+				return err == nil
+			}
+			return htmlDetector(func(s *goquery.Selection) bool {
+				return s.Find(`span[itemprop="dateCreated"]`).Length() > 0
+			})(path)
+		},
+		Load: localLoader("gplus"),
+	})
+}
+
+// htmlDetector returns the function that tells whether the file is an
+// HTML page that the match function likes.
+func htmlDetector(match func(*goquery.Selection) bool) func(string) bool {
+	return func(path string) bool {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".html", ".htm":
+		default:
+			return false
+		}
+		s, err := loadHtmlFile(path, nil)
+		return err == nil && match(s)
+	}
+}
+
+// localLoader returns the Load function for the blog type; the pages
+// are loaded with the default options. The converters load them with
+// their own, see importPages.
+func localLoader(blogType string) func(string) ([]importer.Page, error) {
+	return func(path string) ([]importer.Page, error) {
+		c, err := New(DefaultOptions())
+		if err != nil {
+			return nil, err
+		}
+		pages, err := c.loadPages(path, blogType)
+		var ips []importer.Page
+		for _, p := range pages {
+			ips = append(ips, sourcePage{p})
+		}
+		return ips, err
+	}
+}
+
+// sourcePage is a page of one of the blog types known-to-hugo has, as
+// the importers have it.
+type sourcePage struct {
+	page
+}
+
+func (p sourcePage) Title() string                  { return p.title() }
+func (p sourcePage) Date() time.Time                { return p.date() }
+func (p sourcePage) Content() *goquery.Selection    { return p.content().Selection }
+func (p sourcePage) CanonicalURL() string           { return p.canonicalUrl() }
+func (p sourcePage) Tags() []string                 { return p.tags() }
+func (p sourcePage) Webmentions() []byte            { return p.webmentions() }
+func (p sourcePage) Params() map[string]interface{} { return pageParams(p.page) }
+func (p sourcePage) Files() map[string]string       { return pageFiles(p.page) }
+
+// importedPage is a page an importer known-to-hugo knows nothing about
+// has made.
+type importedPage struct {
+	importer.Page
+}
+
+func (p importedPage) title() string        { return p.Title() }
+func (p importedPage) date() time.Time      { return p.Date() }
+func (p importedPage) content() pageContent { return pageContent{p.Content()} }
+func (p importedPage) canonicalUrl() string { return p.CanonicalURL() }
+func (p importedPage) tags() []string       { return p.Tags() }
+func (p importedPage) webmentions() []byte  { return p.Webmentions() }
+
+func (p importedPage) params() map[string]interface{} {
+	if pp, ok := p.Page.(importer.ParamsPage); ok {
+		return pp.Params()
+	}
+	return nil
+}
+
+func (p importedPage) files() map[string]string {
+	if fp, ok := p.Page.(importer.FilesPage); ok {
+		return fp.Files()
+	}
+	return nil
+}
+
+// importPages loads the pages the importer finds in the file; the ones
+// of the blog types known-to-hugo has are loaded with the options of the
+// converter.
+func (c *Converter) importPages(path string, imp importer.Importer) ([]page, error) {
+	if blogType, ok := localTypes[imp.Name]; ok {
+		return c.loadPages(path, blogType)
+	}
+	ips, err := imp.Load(path)
+	var pages []page
+	for _, ip := range ips {
+		pages = append(pages, fromImporter(ip))
+	}
+	return pages, err
+}
+
+// fromImporter returns the page the importer has made as the page to
+// save.
+func fromImporter(p importer.Page) page {
+	if sp, ok := p.(sourcePage); ok {
+		return sp.page
+	}
+	return importedPage{p}
+}
+
+// localTypes are the blog types of the importers known-to-hugo has, by
+// the importer names.
+var localTypes = map[string]string{
+	"diary.ru":  "diary",
+	"lj_backup": "ljbackup",
+	"lj_xml":    "ljxml",
+	"gplus":     "gplus",
+}
+
+// htmlTypes are the blog types of the importers whose backups are HTML
+// pages, by the importer names.
+var htmlTypes = map[string]string{
+	"diary.ru":  "diary",
+	"lj_backup": "ljbackup",
+	"gplus":     "gplus",
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+func TestDetectImporter(t *testing.T) {
+	tests := map[string]string{
+		"diary_markup.htm":     "diary.ru",
+		"ljb_f.html":           "lj_backup",
+		"gp1.html":             "gplus",
+		"gp_takeout.json":      "gplus",
+		"ljdump/L-664":         "lj_xml",
+		"ljexport/2008-11.xml": "lj_xml",
+		"tired.html":           "",
+		"ljdump/C-664":         "",
+	}
+
+	for fn, want := range tests {
+		t.Run(fn, func(t *testing.T) {
+			var got string
+			for _, i := range importer.All() {
+				if i.Detect(filepath.Join("testdata", filepath.FromSlash(fn))) {
+					got = i.Name
+				}
+			}
+			if got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+		})
+	}
+
+	if i, ok := importer.Detect(filepath.Join("testdata", "ljexport")); !ok || i.Name != "lj_xml" {
+		t.Fatalf("want lj_xml for the directory, got %q", i.Name)
+	}
+}
+
+func TestImportedPage(t *testing.T) {
+	in, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(in)
+	out := filepath.Join(in, "out")
+	if err := ioutil.WriteFile(filepath.Join(in, "post.txt"), []byte("Hello, world!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imp := importer.Importer{
+		Name: "txt",
+		Load: func(path string) ([]importer.Page, error) {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			d, err := goquery.NewDocumentFromReader(strings.NewReader("<p>" + string(b) + "</p>"))
+			if err != nil {
+				return nil, err
+			}
+			return []importer.Page{txtPage{d.Find("body")}}, nil
+		},
+	}
+	if errs := testConverter(t).blogDir(in, out, imp); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(out, "2020", "post", "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`title = "Text"`, `mood = "fine"`, "Hello, world!"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("no %s in:\n%s", want, b)
+		}
+	}
+}
+
+type txtPage struct {
+	sel *goquery.Selection
+}
+
+func (p txtPage) Title() string                  { return "Text" }
+func (p txtPage) Date() time.Time                { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+func (p txtPage) Content() *goquery.Selection    { return p.sel }
+func (p txtPage) CanonicalURL() string           { return "post.txt" }
+func (p txtPage) Tags() []string                 { return nil }
+func (p txtPage) Webmentions() []byte            { return nil }
+func (p txtPage) Params() map[string]interface{} { return map[string]interface{}{"mood": "fine"} }
+
+func TestFailedAssets(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	src, err := filepath.Abs(filepath.Join("testdata", "gp_takeout.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the files on the disk are only copied when the importer says so
+	missing := "file://" + src
+	d, err := goquery.NewDocumentFromReader(strings.NewReader(`<p><img src="` + ts.URL + `/gp_takeout.jpg"><a href="` + missing + `"><img src="` + missing + `"></a></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := testConverter(t).pageBundle(importedPage{txtPage{d.Find("body")}}, "post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.AssetErrors) != 1 {
+		t.Fatalf("want 1 asset error, got %v", b.AssetErrors)
+	}
+	if _, ok := b.Files["image0"]; !ok {
+		t.Error("want the image that was fetched in the bundle")
+	}
+	if _, ok := b.Files["image1"]; ok {
+		t.Error("want no file for the image that failed")
+	}
+	md := string(b.Files["index.md"])
+	if !strings.Contains(md, "(image0)") || !strings.Contains(md, "[![]("+missing+")]("+missing+")") {
+		t.Errorf("want the URL of the image that failed kept, got:\n%s", md)
+	}
+}
@@ -0,0 +1,551 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
+)
+
+const (
+	frontMatterSeparator = "+++\n"
+	knownTimeLayout      = "2006-01-02T15:04:05-0700"
+)
+
+// The comments and reactions are saved the way the importers make them.
+type (
+	content = importer.Content
+	author  = importer.Author
+	mention = importer.Mention
+)
+
+// processPages converts the Known posts at the URLs and saves them to
+// the output directory, returning the failures.
+func (c *Converter) processPages(pages []string, defaultImage, output string) []*ItemError {
+	var errors []*ItemError
+	errC := make(chan []*ItemError)
+	counter := 0
+	sem := make(chan struct{}, c.opts.Concurrency)
+	for _, page := range pages {
+		counter++
+		go c.processPage(sem, errC, page, defaultImage, output)
+	}
+	for i := 0; i < counter; i++ {
+		errors = append(errors, <-errC...)
+	}
+	return errors
+}
+
+func (c *Converter) processPage(sem chan struct{}, errC chan []*ItemError, url, defaultImage, output string) {
+	sem <- struct{}{}
+	defer func() { <-sem }()
+
+	errs := c.convertPage(url, defaultImage, output)
+	c.logFailures(errs)
+	errC <- errs
+}
+
+// convertPage converts the Known post at the URL and saves it to the
+// output directory, returning the failures.
+func (c *Converter) convertPage(url, defaultImage, output string) []*ItemError {
+	c.log.Info("processing", "url", url)
+	d, err := getPage(url)
+	if err != nil {
+		return []*ItemError{itemError(url, StageFetch, err)}
+	}
+	b, err := c.knownBundle(d.Find("html"), url, defaultImage)
+	if err != nil {
+		return []*ItemError{err.(*ItemError)}
+	}
+	errs := assetErrors(url, b)
+	if err := b.Write(output); err != nil {
+		return append(errs, itemError(url, StageWrite, err))
+	}
+	atomic.AddInt64(&c.stats.Processed, 1)
+	return errs
+}
+
+// knownBundle makes the bundle of the Known post found at the URL. The
+// error it returns is an *ItemError.
+func (c *Converter) knownBundle(sel *goquery.Selection, url, defaultImage string) (*Bundle, error) {
+	p, err := c.newKnownPage(sel, url, defaultImage)
+	if err != nil {
+		return nil, itemError(url, StageLoad, err)
+	}
+	b, err := c.pageBundle(p, p.canonicalUrl())
+	if err != nil {
+		return nil, itemError(url, StageConvert, err)
+	}
+	return b, nil
+}
+
+// knownPage is a post of a Known website.
+type knownPage struct {
+	sel       *goquery.Selection
+	slug      string
+	alias     string
+	dt        time.Time
+	cnt       pageContent
+	featured  string
+	assets    map[string]string
+	summaries bool
+}
+
+// newKnownPage makes the page of the Known post found at the URL. The
+// files the post links to are saved with it, and the links to the
+// website itself are made relative.
+func (c *Converter) newKnownPage(sel *goquery.Selection, url, defaultImage string) (*knownPage, error) {
+	dt, err := time.Parse(knownTimeLayout, getDtPublished(sel))
+	if err != nil {
+		return nil, fmt.Errorf("can not parse the date: %w", err)
+	}
+	p := &knownPage{sel: sel, dt: dt, cnt: getContent(sel), assets: map[string]string{}, summaries: c.opts.Summaries}
+	if p.slug, err = getPostSlug(url, dt.Format("2006")); err != nil {
+		return nil, err
+	}
+	if p.alias, err = getRelPermalink(sel); err != nil {
+		return nil, err
+	}
+
+	featured := getFeaturedImage(sel)
+	if featured != defaultImage {
+		p.featured = featured
+	}
+	p.cnt.Find("img").Each(func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		if src == featured {
+			p.featured = imageName(i)
+		}
+		s.SetAttr("src", strings.TrimSuffix(src, "/thumb.jpg"))
+	})
+	processLinksToFiles(p.cnt, p.assets, c.opts.Website)
+	processLinksToOwnSite(p.cnt, c.opts.Website)
+	return p, nil
+}
+
+func (p *knownPage) title() string {
+	return getTitle(p.sel)
+}
+
+func (p *knownPage) date() time.Time {
+	return p.dt
+}
+
+func (p *knownPage) content() pageContent {
+	return p.cnt
+}
+
+func (p *knownPage) canonicalUrl() string {
+	return p.slug
+}
+
+func (p *knownPage) tags() []string {
+	return getTags(p.sel)
+}
+
+func (p *knownPage) webmentions() []byte {
+	b, _ := getWebmentions(p.sel)
+	return b
+}
+
+func (p *knownPage) files() map[string]string {
+	return p.assets
+}
+
+// id makes up an ID for the post, since Known doesn't show any.
+func (p *knownPage) id() string {
+	return p.dt.Format("20060102150405")
+}
+
+func (p *knownPage) params() map[string]interface{} {
+	params := map[string]interface{}{
+		"aliases":        []string{p.alias},
+		"featured_image": p.featured,
+		"reply_to":       getInReply(p.sel),
+		"posse":          getSyndications(p.sel),
+		"like_of":        getLikeOf(p.sel),
+	}
+	if p.summaries {
+		addSummary(params, ogSummary(p.sel), false)
+	}
+	return params
+}
+
+func getWebmentions(sel *goquery.Selection) ([]byte, bool) {
+	var mentions = struct {
+		Type     string    `json:"type"`
+		Name     string    `json:"name"`
+		Children []mention `json:"children,omitempty"`
+	}{Type: "feed", Name: "Webmentions"}
+
+	sel.Find(".annotations").Find(".idno-annotation").Each(func(i int, s *goquery.Selection) {
+		m := getMention(s)
+		mentions.Children = append(mentions.Children, m)
+	})
+	if len(mentions.Children) > 0 {
+		b, err := json.MarshalIndent(mentions, "", " ")
+		if err != nil {
+			panic(err)
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+func getMention(sel *goquery.Selection) mention {
+	var m = mention{
+		Type:   "entry",
+		Author: getMentionAuthor(sel),
+	}
+	if c, ok := getMentionContent(sel); ok {
+		m.Content = c
+	}
+	if t, ok := getMentionType(sel); ok {
+		m.Property = t
+	}
+	m.Url, m.Date = getMentionSource(sel)
+	return m
+}
+
+func getMentionType(sel *goquery.Selection) (string, bool) {
+	s := sel.Find(".idno-annotation-content").Find("p").Eq(0)
+	if s.Parent().Is(".e-content") {
+		return "comment", false
+	}
+	a := s.Find("a").Eq(1).Text()
+	if strings.HasPrefix(a, "reshared") {
+		return "repost-of", true
+	}
+	a = s.Text()
+	if strings.HasSuffix(strings.TrimSpace(a), "liked this post") {
+		return "like-of", true
+	}
+	return a, true
+}
+
+func getMentionSource(sel *goquery.Selection) (url, date string) {
+	s := sel.Find(".idno-annotation-content").Find("a").Eq(-2)
+	d := s.Text()
+	dt, err := time.Parse("Jan 02 2006", d)
+	if err != nil {
+		date = d
+	} else {
+		date = dt.Format("2006-01-02")
+	}
+	url, _ = s.Attr("href")
+	return
+}
+
+func getMentionAuthor(sel *goquery.Selection) author {
+	p, _ := sel.Find(".idno-annotation-image").Find("img").Attr("src")
+	au := sel.Find(".idno-annotation-content").Find("a").Eq(0)
+	n := au.Text()
+	u, _ := au.Attr("href")
+	s := sel.Find(".h-card")
+	if s.Is(".h-card") {
+		n = s.Find(".p-name").Text()
+		u, _ = s.Find(".p-name").Attr("href")
+		p, _ = s.Find(".u-photo").Attr("href")
+	}
+	return author{Type: "card", Name: n, Url: u, Photo: p}
+}
+
+func getMentionContent(sel *goquery.Selection) (content, bool) {
+	cont := sel.Find(".e-content")
+	if cont.Is(".e-content") {
+		text := cont.Text()
+		html, _ := cont.Html()
+		return content{Text: text, Html: html}, true
+	}
+	return content{}, false
+}
+
+func processLinksToOwnSite(c pageContent, website string) {
+	prefix := strings.TrimSuffix(website, "/")
+	c.Find("a").Each(func(i int, s *goquery.Selection) {
+		link, _ := s.Attr("href")
+		rel := strings.TrimPrefix(link, prefix)
+		s.SetAttr("href", rel)
+	})
+}
+
+func processLinksToFiles(c pageContent, files map[string]string, website string) {
+	fPrefix := strings.TrimSuffix(website, "/") + "/file/"
+	c.Find("a").Each(func(i int, s *goquery.Selection) {
+		link, _ := s.Attr("href")
+		if strings.HasPrefix(link, fPrefix) {
+			pts := strings.Split(link, "/")
+			fn := strconv.Itoa(i) + pts[len(pts)-1]
+			files[fn] = link
+			changeHrefs(c.Selection, link, fn)
+		}
+	})
+}
+
+func changeHrefs(se *goquery.Selection, link, fn string) {
+	se.Find("a").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if href == link {
+			s.SetAttr("href", fn)
+		}
+	})
+}
+
+func getPostSlug(uri, year string) (string, error) {
+	u, err := parseURL(uri)
+	if err != nil {
+		return "", err
+	}
+	slug := strings.TrimPrefix(u.Path, "/"+year+"/")
+	return slug, nil
+}
+
+// parseURL parses the URL of a Known post.
+func parseURL(uri string) (*url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		// Known is buggy as hell
+		uf := fixURL(uri)
+		u, err = url.Parse(uf)
+	}
+	return u, err
+}
+
+func (c *Converter) getPostLinks(url string) []string {
+	var links []string
+	next := true
+	for next {
+		c.log.Info("listing posts", "url", url)
+		d, err := getPage(url)
+		if err != nil {
+			c.log.Error("failed to list posts", "url", url, "error", err)
+			break
+		}
+		s := d.Find("html")
+		var nurl string
+		nurl, next = s.Find(".older").Find("a").Attr("href")
+		// Known is buggy as hell:
+		if nurl == url {
+			next = false
+		}
+		url = nurl
+		found := getPostLinksFromPage(s)
+		atomic.AddInt64(&c.stats.Discovered, int64(len(found)))
+		links = append(links, found...)
+	}
+	return links
+}
+
+func getPostLinksFromPage(sel *goquery.Selection) []string {
+	var links []string
+	sel.Find(".idno-entry").Each(func(i int, s *goquery.Selection) {
+		link := getPermalink(s)
+		links = append(links, link)
+	})
+	return links
+}
+
+func getContent(sel *goquery.Selection) pageContent {
+	c := sel.Clone()
+	c.Find(".annotations").Remove()
+	c.Find(".p-category").Remove()
+	return pageContent{c.Find(".e-content")}
+}
+
+func getInReply(sel *goquery.Selection) []string {
+	var irt []string
+	sel.Find(".u-in-reply-to").Each(func(i int, s *goquery.Selection) {
+		rep, _ := s.Attr("href")
+		irt = append(irt, rep)
+	})
+	return irt
+}
+
+func getLikeOf(sel *goquery.Selection) string {
+	s := sel.Find(".u-like-of")
+	// Known is awesome :/
+	var like string
+	if l, ok := s.Attr("href"); ok {
+		if l != "" {
+			like = l
+		} else {
+			like, _ = sel.Find(".unfurl").Attr("data-url")
+		}
+	}
+	return like
+}
+
+func getSyndications(sel *goquery.Selection) []string {
+	var irt []string
+	sel.Find(".u-syndication").Each(func(i int, s *goquery.Selection) {
+		rep, _ := s.Attr("href")
+		irt = append(irt, rep)
+	})
+	return irt
+}
+
+func getTags(sel *goquery.Selection) []string {
+	var tags []string
+	sel.Find(".p-category").Each(func(i int, s *goquery.Selection) {
+		tag := strings.TrimPrefix(s.Text(), "#")
+		tags = append(tags, tag)
+	})
+	return tags
+}
+
+func getFeaturedImage(sel *goquery.Selection) string {
+	var img string
+	sel.Find("meta").Each(func(i int, s *goquery.Selection) {
+		v, _ := s.Attr("property")
+		if v == "og:image" {
+			img, _ = s.Attr("content")
+		}
+	})
+	return img
+}
+
+func getDefaultImage(url string) string {
+	d, err := getPage(url)
+	if err != nil {
+		return ""
+	}
+	s := d.Find("html")
+	return getFeaturedImage(s)
+}
+
+func getTitle(sel *goquery.Selection) string {
+	v := sel.Find(".idno-body").Find(".p-name").Find("a").Text()
+	return v
+}
+
+func getPermalink(sel *goquery.Selection) string {
+	v, _ := sel.Find(".permalink").Find(".u-url").Attr("href")
+	v, _ = url.PathUnescape(v)
+	return v
+}
+
+func getRelPermalink(sel *goquery.Selection) (string, error) {
+	u, err := parseURL(getPermalink(sel))
+	if err != nil {
+		return "", err
+	}
+	return u.Path, nil
+}
+
+func getDtPublished(sel *goquery.Selection) string {
+	v, _ := sel.Find(".dt-published").Attr("datetime")
+	return v
+}
+
+func getPage(uri string) (*goquery.Document, error) {
+	res, err := http.Get(uri)
+	if err != nil {
+		// Known is buggy as hell
+		u := fixURL(uri)
+		res, err = http.Get(u)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse URL")
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		err := fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+		return nil, fmt.Errorf("can not get page: %w", err)
+	}
+
+	// Load the HTML document
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse page: %w", err)
+	}
+
+	return doc, nil
+}
+
+// fixURL escapes the slug of the URL of a Known post, which Known
+// doesn't always do.
+func fixURL(uri string) string {
+	site := uri
+	if i := strings.Index(uri, "://"); i >= 0 {
+		if j := strings.Index(uri[i+3:], "/"); j >= 0 {
+			site = uri[:i+3+j]
+		}
+	}
+	pth := strings.TrimPrefix(uri, site)
+	pth = strings.TrimPrefix(pth, "/")
+	comps := strings.SplitN(pth, "/", 2)
+	if len(comps) < 2 {
+		return ""
+	}
+	parts := []string{site, comps[0], url.PathEscape(comps[1])}
+	res := strings.Join(parts, "/")
+	return res
+}
+
+// fetchFile downloads the file at the URL. Only the web URLs are
+// fetched: the files of the local backups are copied by the paths the
+// importers have checked, never by the links in the content.
+func fetchFile(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("not a web URL")
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fetchImages returns the contents of the files by their names; the
+// ones the local backup has are copied from the paths it has them at,
+// by their links. The files that can't be fetched are left out, and the
+// errors fetching them are returned.
+func (c *Converter) fetchImages(images, local map[string]string) (map[string][]byte, []error) {
+	files := map[string][]byte{}
+	var errs []error
+	for fn, url := range images {
+		var (
+			b   []byte
+			err error
+		)
+		if path, ok := local[url]; ok {
+			b, err = ioutil.ReadFile(path)
+		} else {
+			b, err = fetchFile(url)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		c.log.Debug("fetched asset", "url", url, "file", fn)
+		atomic.AddInt64(&c.stats.Assets, 1)
+		files[fn] = b
+	}
+	return files, errs
+}
@@ -13,7 +13,7 @@
 // You should have received a copy of the GNU General Public License
 // along with this program. If not, see <https://www.gnu.org/licenses/>.
 
-package main
+package convert
 
 import (
 	"bytes"
@@ -30,6 +30,27 @@ var (
 	update = flag.Bool("update", false, "update .golden files")
 )
 
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(m.Run())
+}
+
+// testConverter returns the converter with the default options, changed
+// by the functions given.
+func testConverter(t *testing.T, set ...func(*Options)) *Converter {
+	t.Helper()
+
+	o := DefaultOptions()
+	for _, f := range set {
+		f(&o)
+	}
+	c, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
 func TestGetTitle(t *testing.T) {
 	s := loadHtml(t, filepath.Join("testdata", "tired.html"))
 	got := getTitle(s)
@@ -65,6 +86,31 @@ func TestGetWebmentions(t *testing.T) {
 	assertGolden(t, got, g)
 }
 
+func TestKnownPage(t *testing.T) {
+	for _, name := range []string{"tired", "eter", "whatever"} {
+		t.Run(name, func(t *testing.T) {
+			s := loadHtml(t, filepath.Join("testdata", name+".html"))
+			c := testConverter(t)
+			p, err := c.newKnownPage(s, getPermalink(s), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, got := mustHugo(t, c, p)
+			assertGolden(t, got, filepath.Join("testdata", name+".md"))
+		})
+	}
+}
+
+func mustHugo(t *testing.T, c *Converter, p page) (string, []byte) {
+	t.Helper()
+
+	name, b, err := c.hugo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name, b
+}
+
 func assertGolden(t *testing.T, actual []byte, golden string) {
 	t.Helper()
 
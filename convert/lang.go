@@ -0,0 +1,186 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	langKey  = "key"
+	langFile = "file"
+
+	// texts shorter than this are not worth guessing about
+	minLangLetters = 20
+)
+
+// langProfiles are the most frequent trigrams of the languages the
+// detector knows, most frequent first; "_" is a word boundary.
+var langProfiles = map[string][]string{
+	"en": {"_th", "the", "he_", "_an", "nd_", "and", "_of", "of_", "_to", "to_", "ing", "ng_", "_in",
+		"in_", "ion", "is_", "_is", "ed_", "_a_", "tio", "ent", "_wa", "for", "_fo", "hat", "tha", "_it",
+		"at_", "ere", "_be", "er_", "es_", "on_", "you", "it_"},
+	"de": {"en_", "er_", "_di", "die", "der", "ie_", "_de", "ich", "ein", "sch", "ch_", "_un", "und",
+		"nd_", "cht", "_ei", "den", "in_", "gen", "ine", "te_", "_ge", "ung", "es_", "ten", "che", "ist",
+		"_is", "st_", "auf", "nde", "_zu"},
+	"fr": {"es_", "_de", "de_", "le_", "_le", "ent", "nt_", "la_", "_la", "les", "_pa", "ion", "re_",
+		"_et", "et_", "que", "_qu", "ue_", "ne_", "on_", "des", "_co", "ait", "men", "our", "_un", "une",
+		"ur_", "est", "_es", "_po", "ous"},
+	"es": {"_de", "de_", "os_", "la_", "_la", "el_", "_el", "es_", "en_", "_qu", "que", "ue_", "_en",
+		"as_", "ado", "ent", "_co", "los", "_lo", "ión", "_se", "con", "del", "par", "_po", "ra_", "nte",
+		"por", "ara", "cio", "_un", "una"},
+	"ru": {"_по", "то_", "ого", "ени", "_не", "не_", "_на", "на_", "_пр", "ть_", "_в_", "_и_", "ой_",
+		"ия_", "что", "_чт", "го_", "ать", "ов_", "ет_", "ал_", "про", "ств", "_ко", "ско", "ние", "ост",
+		"ани", "ли_", "ом_", "ая_", "_со", "сто", "тор", "его", "_то", "ый_", "ых_"},
+	"uk": {"_на", "на_", "_пр", "ння", "ого", "ти_", "_по", "_та", "та_", "_не", "не_", "ся_", "ому",
+		"ні_", "ий_", "_що", "що_", "ати", "ки_", "ів_", "ськ", "ван", "ої_", "ть_", "_і_", "аль", "при",
+		"про", "_в_", "ат_", "ими"},
+}
+
+// langLetters are the letters only some of the languages use.
+var langLetters = map[string]string{
+	"ru": "ыэъё",
+	"uk": "іїєґ",
+	"de": "äöüß",
+	"fr": "àâçèêëîïôœùû",
+	"es": "ñáíóú¿¡",
+}
+
+// pageLang returns the language of the page content, as stated in the
+// markup or detected from the text. The language of the whole page is
+// only used if the text doesn't tell, since that's usually the site's
+// setting rather than the post's.
+func pageLang(c pageContent) string {
+	if l := declaredLang(c.Selection); l != "" {
+		return normalizeLang(l)
+	}
+	if l := detectLang(plainText(c.Selection)); l != "" {
+		return l
+	}
+	return normalizeLang(c.Closest("html").AttrOr("lang", ""))
+}
+
+// declaredLang returns the language stated for the content: on itself or
+// the elements it's in, short of the whole page, or on the element
+// inside it that has most of its text.
+func declaredLang(s *goquery.Selection) string {
+	if l := s.Closest("[lang]").Not("html").AttrOr("lang", ""); l != "" {
+		return l
+	}
+	text := len(strings.TrimSpace(s.Text()))
+	var l string
+	s.Find("[lang]").EachWithBreak(func(_ int, e *goquery.Selection) bool {
+		if 2*len(strings.TrimSpace(e.Text())) >= text {
+			l = e.AttrOr("lang", "")
+		}
+		return l == ""
+	})
+	return l
+}
+
+// cloneContent clones the content out of the page, keeping the language
+// the page states for it.
+func cloneContent(s *goquery.Selection) *goquery.Selection {
+	c := s.Clone()
+	if _, ok := c.Attr("lang"); !ok {
+		if l := s.Closest("[lang]").Not("html").AttrOr("lang", ""); l != "" {
+			c.SetAttr("lang", l)
+		}
+	}
+	return c
+}
+
+func normalizeLang(l string) string {
+	return strings.ToLower(strings.SplitN(strings.Replace(l, "_", "-", 1), "-", 2)[0])
+}
+
+// detectLang guesses the language of the text by the trigrams it has,
+// returning an empty string if it can't.
+func detectLang(text string) string {
+	var b strings.Builder
+	b.WriteRune('_')
+	var cyrillic, latin int
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case !unicode.IsLetter(r):
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	b.WriteRune('_')
+	if cyrillic+latin < minLangLetters {
+		return ""
+	}
+
+	words := strings.FieldsFunc(b.String(), func(r rune) bool { return r == '_' })
+	trigrams := map[string]int{}
+	for _, w := range words {
+		rs := []rune("_" + w + "_")
+		for i := 0; i+3 <= len(rs); i++ {
+			trigrams[string(rs[i:i+3])]++
+		}
+	}
+
+	best, bestScore := "", 0.0
+	for lang, profile := range langProfiles {
+		if isCyrillic(lang) != (cyrillic > latin) {
+			continue
+		}
+		var score float64
+		for i, t := range profile {
+			score += float64(trigrams[t]) * float64(len(profile)-i) / float64(len(profile))
+		}
+		for _, r := range langLetters[lang] {
+			score += 2 * float64(strings.Count(b.String(), string(r)))
+		}
+		if score > bestScore || score == bestScore && lang < best {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
+
+// checkLang tells whether the language strategy is one known-to-hugo
+// has; the language is not detected if it's not set.
+func checkLang(strategy string) error {
+	switch strategy {
+	case "", langKey, langFile:
+		return nil
+	}
+	return fmt.Errorf("%s: unknown language strategy", strategy)
+}
+
+func isCyrillic(lang string) bool {
+	return lang == "ru" || lang == "uk"
+}
+
+// langFileName inserts the language into the content file name the way
+// Hugo's multilingual mode expects it.
+func langFileName(name, lang string) string {
+	if lang == "" {
+		return name
+	}
+	i := strings.LastIndex(name, ".")
+	return name[:i] + "." + lang + name[i:]
+}
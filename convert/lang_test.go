@@ -0,0 +1,92 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDetectLang(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		want string
+	}{
+		"en":    {"It is the first time in the history of the project that the tests are run on every commit.", "en"},
+		"ru":    {"Это первый раз в истории проекта, когда тесты запускаются на каждом коммите, и что бы ни случилось.", "ru"},
+		"uk":    {"Це перший раз в історії проекту, коли тести запускаються на кожному коміті, і що б не сталося.", "uk"},
+		"de":    {"Das ist das erste Mal in der Geschichte des Projekts, dass die Tests bei jedem Commit laufen.", "de"},
+		"fr":    {"C'est la première fois dans l'histoire du projet que les tests sont lancés pour chaque commit.", "fr"},
+		"es":    {"Es la primera vez en la historia del proyecto que las pruebas se ejecutan en cada commit.", "es"},
+		"short": {"Да.", ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertString(t, tc.want, detectLang(tc.text))
+		})
+	}
+}
+
+func TestPageLang(t *testing.T) {
+	tests := map[string]struct {
+		html  string
+		want  string
+		clone bool
+	}{
+		"attribute":      {`<html lang="ru"><body><div class="e-content" lang="en-GB"><p>Да</p></div></body></html>`, "en", false},
+		"site attribute": {`<html lang="en"><body><div class="e-content"><p>Это первый раз в истории проекта, когда тесты запускаются.</p></div></body></html>`, "ru", false},
+		"inner":          {`<html lang="ru"><body><div class="e-content"><p lang="de">Ja.</p></div></body></html>`, "de", false},
+		"inner quote":    {`<html><body><div class="e-content"><p>Это первый раз в истории проекта, когда тесты запускаются.</p><q lang="en">Yes.</q></div></body></html>`, "ru", false},
+		"site fallback":  {`<html lang="uk"><body><div class="e-content"><p>Так.</p></div></body></html>`, "uk", false},
+		"cloned":         {`<html lang="ru"><body><article lang="en"><div class="e-content"><p>Да</p></div></article></body></html>`, "en", true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := d.Find(".e-content")
+			if tc.clone {
+				s = cloneContent(s)
+			}
+			assertString(t, tc.want, pageLang(pageContent{s}))
+		})
+	}
+}
+
+func TestHugoLang(t *testing.T) {
+	s, err := loadHtmlFile(filepath.Join("testdata", "gp1.html"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testConverter(t, func(o *Options) { o.Lang = langFile })
+	name, _ := mustHugo(t, c, gpPage{s})
+	assertString(t, "index.ru.md", name)
+
+	c = testConverter(t, func(o *Options) { o.Lang = langKey })
+	name, b := mustHugo(t, c, gpPage{s})
+	assertString(t, "index.md", name)
+	if !strings.Contains(string(b), `lang = "ru"`) {
+		t.Fatalf("no language in front matter:\n%s", b)
+	}
+}
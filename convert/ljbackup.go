@@ -0,0 +1,332 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ljbUserpic is the name the entry's userpic is saved under.
+const ljbUserpic = "userpic"
+
+// ljbMeta are the labels ljArchive puts before the metadata of the entry,
+// and the keys to save them under.
+var ljbMeta = []struct {
+	label, key string
+}{
+	{"current mood", "mood"},
+	{"настроение", "mood"},
+	{"current music", "music"},
+	{"музыка", "music"},
+	{"current location", "location"},
+	{"местонахождение", "location"},
+	{"adult content", "adult"},
+	{"содержимое для взрослых", "adult"},
+}
+
+type ljbPage struct {
+	*goquery.Selection
+	cnt   pageContent
+	opts  ljOptions
+	local map[string]string
+}
+
+// newLJBPage returns the entry of the page. The content is made once, so
+// that the changes made to it, like the images saved with the bundle,
+// stay.
+func newLJBPage(s *goquery.Selection, o ljOptions) ljbPage {
+	p := ljbPage{Selection: s, opts: o}
+	p.cnt = p.makeContent()
+	return p
+}
+
+// ljbDeleted is how LiveJournal marks the comments that were deleted.
+var ljbDeleted = []string{"Deleted comment", "Удалённый комментарий", "Удаленный комментарий"}
+
+type ljbComment struct {
+	*goquery.Selection
+	parent string
+}
+
+func (p ljbPage) canonicalUrl() string {
+	u, _ := p.Find(".lesstop").Find("a").Attr("href")
+	uri, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(uri.Path)
+}
+
+func (p ljbPage) content() pageContent {
+	return p.cnt
+}
+
+func (p ljbPage) makeContent() pageContent {
+	s := cloneContent(p.Find("body"))
+	s.Find("hr").NextAll().AndSelf().Remove()
+	s.Find("blockquote").PrevAll().AndSelf().Remove()
+	s.Find("td").Each(func(_ int, sel *goquery.Selection) {
+		if d := sel.Text(); d == "Entry tags:" {
+			sel.ParentsUntil("table").Remove()
+		} else if ljbMetaKey(d) != "" {
+			sel.Parent().Remove()
+		}
+	})
+	convertLJMarkup(s)
+	s.Find("br").ReplaceWithHtml("<p>")
+	t := s.Find("font").Eq(0)
+	if t.Text() == p.title() {
+		t.Remove()
+	}
+	t = s.Find("img").Eq(0)
+	if _, ok := ljSecurityIcon(t.AttrOr("src", "")); ok {
+		t.Remove()
+	}
+	return pageContent{s}
+}
+
+// security returns the security level of the entry, as shown by the
+// icon next to its title.
+func (p ljbPage) security() string {
+	level := ljPublic
+	p.Find("body img").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if l, ok := ljSecurityIcon(s.AttrOr("src", "")); ok {
+			level = l
+			return false
+		}
+		return true
+	})
+	return level
+}
+
+func (p ljbPage) date() time.Time {
+	d := p.Find("td").Eq(1).Find("font").Text()
+	d = strings.TrimPrefix(d, "@ ")
+	dt, _ := time.ParseInLocation("2006-01-02 15:04:05", d, time.Local)
+	return dt
+}
+
+func (p ljbPage) title() string {
+	t := p.Find("title").Text()
+	ct := p.Find("body").Find("p").Eq(1).Find("font").Text()
+	u := p.Find(".ljuser").Eq(0).Text()
+	if t == u+": "+ct {
+		return ct
+	}
+	return ""
+}
+
+func (p ljbPage) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if t := ljCutText(p.Find("body")); t != "" {
+		params["read_more"] = t
+	}
+	if lj := p.meta(); len(lj) > 0 {
+		params["lj"] = lj
+	}
+	if sec := p.security(); sec != ljPublic {
+		params["access"] = sec
+		if p.opts.securityPolicy(sec) == policyDraft {
+			params["draft"] = true
+		}
+	}
+	return params
+}
+
+// meta returns the metadata of the entry: the mood, music, location and
+// adult content level, and the userpic it was posted with.
+func (p ljbPage) meta() map[string]string {
+	meta := map[string]string{}
+	p.Find("td").Each(func(_ int, s *goquery.Selection) {
+		k := ljbMetaKey(s.Text())
+		if k == "" {
+			return
+		}
+		v := s.Next()
+		t := strings.TrimSpace(v.Text())
+		if t == "" {
+			t = strings.TrimSpace(v.Find("img").AttrOr("alt", ""))
+		}
+		if t != "" {
+			meta[k] = t
+		}
+	})
+	if a := p.Find(`meta[name="adult_content"]`).AttrOr("content", ""); a != "" && a != "none" {
+		meta["adult"] = a
+	}
+	if p.userpic() != "" {
+		meta["userpic"] = ljbUserpic
+	}
+	return meta
+}
+
+func ljbMetaKey(label string) string {
+	l := strings.ToLower(strings.TrimSpace(label))
+	if !strings.HasSuffix(l, ":") {
+		return ""
+	}
+	for _, m := range ljbMeta {
+		if strings.HasPrefix(l, m.label) {
+			return m.key
+		}
+	}
+	return ""
+}
+
+// userpic returns the URL of the userpic the entry was posted with.
+func (p ljbPage) userpic() string {
+	return p.Find("body").Find("table").First().Find("td").First().Find("img").AttrOr("src", "")
+}
+
+func (p ljbPage) files() map[string]string {
+	if u := p.userpic(); u != "" {
+		return map[string]string{ljbUserpic: u}
+	}
+	return nil
+}
+
+// localFiles returns the images saved along with the page, the userpic
+// among them.
+func (p ljbPage) localFiles() map[string]string {
+	return p.local
+}
+
+func (p ljbPage) tags() []string {
+	var t []string
+	p.Find("td").Eq(3).Find("a").Each(func(_ int, s *goquery.Selection) {
+		t = append(t, s.Text())
+	})
+	return t
+}
+
+func (p ljbPage) webmentions() []byte {
+	parents := p.commentParents()
+	var cs []ljThreadComment
+	p.Find(`.talk-comment, [id^="ljcmt"]:not(.talk-comment):not(:has(.talk-comment))`).Each(func(i int, s *goquery.Selection) {
+		cmt := ljbComment{Selection: s}
+		cmt.parent = parents[cmt.id()]
+		cs = append(cs, cmt)
+	})
+	return ljWebmentions(cs, p.opts.keepScreened)
+}
+
+// commentParents returns the IDs of the comments the comments reply to,
+// as LiveJournal lists the replies to each comment in LJ_cmtinfo.
+func (p ljbPage) commentParents() map[string]string {
+	parents := map[string]string{}
+	p.Find("script").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		t := s.Text()
+		i := strings.Index(t, "LJ_cmtinfo")
+		if i < 0 {
+			return true
+		}
+		j := strings.Index(t[i:], "{")
+		if j < 0 {
+			return true
+		}
+		var info map[string]json.RawMessage
+		if err := json.NewDecoder(strings.NewReader(t[i+j:])).Decode(&info); err != nil {
+			return true
+		}
+		for id, raw := range info {
+			var c struct {
+				Replies []int `json:"rc"`
+			}
+			if json.Unmarshal(raw, &c) != nil {
+				continue
+			}
+			for _, r := range c.Replies {
+				parents[strconv.Itoa(r)] = id
+			}
+		}
+		return false
+	})
+	return parents
+}
+
+func (c ljbComment) author() author {
+	s := c.Find(".ljuser").Find("a").Eq(1)
+	n := s.Text()
+	u, _ := s.Attr("href")
+	return author{Type: "card", Name: n, Url: u}
+}
+
+func (c ljbComment) content() content {
+	s := c.Find("td").Eq(-1).Clone()
+	s.Find("font").Parent().Remove()
+	t := s.Text()
+	h, _ := s.Html()
+	return content{Text: t, Html: h}
+}
+
+func (c ljbComment) url() string {
+	u, _ := c.Find("td").Eq(1).Find("font").Eq(2).Find("a").Attr("href")
+	return u
+}
+
+func (c ljbComment) date() string {
+	d := c.Find("td").Eq(1).Find("font").Eq(1).Text()
+	d = strings.TrimSuffix(d, " (local)")
+	t, err := time.ParseInLocation("2006-01-02 03:04 pm", d, time.Local)
+	if err != nil && c.state() == commentDeleted {
+		return ""
+	}
+	return t.String()
+}
+
+func (c ljbComment) id() string {
+	if id, ok := c.Find(`[id^="cmtbar"]`).Attr("id"); ok {
+		return strings.TrimPrefix(id, "cmtbar")
+	}
+	id, _ := c.Closest(`[id^="ljcmt"]`).Attr("id")
+	return strings.TrimPrefix(id, "ljcmt")
+}
+
+func (c ljbComment) parentID() string {
+	return c.parent
+}
+
+// state tells whether the comment was deleted, or screened or frozen,
+// as shown by the buttons to undo that.
+func (c ljbComment) state() string {
+	switch {
+	case c.Find(".ljuser").Length() == 0 && c.isDeleted():
+		return commentDeleted
+	case c.Find(`a[href*="mode=unscreen"]`).Length() > 0,
+		c.Find(`[id^="cmtbar"]`).AttrOr("bgcolor", "") == "#d0d0d0":
+		return commentScreened
+	case c.Find(`a[href*="mode=unfreeze"]`).Length() > 0:
+		return commentFrozen
+	}
+	return ""
+}
+
+func (c ljbComment) isDeleted() bool {
+	t := c.Text()
+	for _, d := range ljbDeleted {
+		if strings.Contains(t, d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLJMeta(t *testing.T) {
+	c := testConverter(t)
+	p, err := c.loadPage(filepath.Join("testdata", "ljb_meta.html"), "ljbackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "16734.html", p.canonicalUrl())
+
+	abs, err := filepath.Abs(filepath.Join("testdata", "ljb_userpic.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ = c.withSlug(p, "16734", "16734")
+	userpic := pageFiles(p)[ljbUserpic]
+	assertString(t, "ljb_userpic.gif", userpic)
+	assertString(t, abs, pageLocalFiles(p)[userpic])
+
+	_, got := mustHugo(t, c, p)
+	assertGolden(t, got, filepath.Join("testdata", "ljb_meta.md"))
+}
+
+func TestLJLocalImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "ljbackup.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = bytes.Replace(b, []byte("По крайней мере"), []byte("<img src='photo.gif'><img src='../secret.gif'>По крайней мере"), 1)
+	archive := filepath.Join(dir, "archive")
+	if err := os.Mkdir(archive, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(archive, "170041.html"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ioutil.ReadFile(filepath.Join("testdata", "ljb_userpic.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(archive, "photo.gif"), img, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// outside the archive, so it's not to be copied
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret.gif"), img, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := c.ConvertFile(filepath.Join(archive, "170041.html"), "lj_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 1 {
+		t.Fatalf("want 1 bundle, got %d", len(bundles))
+	}
+	md := bundles[0].Files["index.md"]
+	if !bytes.Contains(md, []byte("(image0")) || bytes.Contains(md, []byte("file://")) {
+		t.Errorf("want the image saved with the bundle, got:\n%s", md)
+	}
+	if !bytes.Equal(bundles[0].Files["image0"], img) {
+		t.Errorf("want the image in the bundle, got files %v", len(bundles[0].Files))
+	}
+	if _, ok := bundles[0].Files["image1"]; ok || !bytes.Contains(md, []byte("(../secret.gif)")) {
+		t.Errorf("want the image outside the archive left as is, got:\n%s", md)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	commentScreened = "screened"
+	commentDeleted  = "deleted"
+	commentFrozen   = "frozen"
+)
+
+// ljThreadComment is a LiveJournal comment that knows its place in the
+// thread, and whether it was screened, deleted or frozen.
+type ljThreadComment interface {
+	comment
+	id() string
+	parentID() string
+	state() string
+}
+
+// ljCommentState returns the state the LiveJournal archives mark the
+// comments with as the one to put into the webmentions.
+func ljCommentState(s string) string {
+	switch strings.ToUpper(s) {
+	case "S":
+		return commentScreened
+	case "D":
+		return commentDeleted
+	case "F":
+		return commentFrozen
+	}
+	return ""
+}
+
+// ljWebmentions returns the webmentions for the comments that are to be
+// published: the deleted comments and the screened ones (unless they are
+// kept) are dropped, but the ones other comments reply to are left as
+// empty placeholders, so that the threads stay whole.
+func ljWebmentions(cs []ljThreadComment, keepScreened bool) []byte {
+	var mentions = struct {
+		Type     string    `json:"type"`
+		Name     string    `json:"name"`
+		Children []mention `json:"children,omitempty"`
+	}{Type: "feed", Name: "Webmentions"}
+
+	byID := map[string]int{}
+	urls := map[string]string{}
+	visible := make([]bool, len(cs))
+	for i, c := range cs {
+		byID[c.id()] = i
+		urls[c.id()] = c.url()
+		switch c.state() {
+		case commentDeleted:
+		case commentScreened:
+			visible[i] = keepScreened
+		default:
+			visible[i] = true
+		}
+	}
+
+	placeholder := make([]bool, len(cs))
+	for i, c := range cs {
+		if !visible[i] {
+			continue
+		}
+		for j, ok := byID[c.parentID()]; ok && !visible[j] && !placeholder[j]; j, ok = byID[cs[j].parentID()] {
+			placeholder[j] = true
+		}
+	}
+
+	for i, c := range cs {
+		if !visible[i] && !placeholder[i] {
+			continue
+		}
+		m := getWebmention(c)
+		m.State = c.state()
+		if placeholder[i] {
+			m.Author = author{}
+			m.Content = content{}
+		}
+		m.Parent = urls[c.parentID()]
+		mentions.Children = append(mentions.Children, m)
+	}
+
+	if len(mentions.Children) > 0 {
+		b, err := json.MarshalIndent(mentions, "", " ")
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+	return nil
+}
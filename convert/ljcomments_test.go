@@ -0,0 +1,133 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestLJCommentStates(t *testing.T) {
+	tests := map[string]struct {
+		keep bool
+		want []string
+	}{
+		"drop screened": {false, []string{"", "", commentDeleted, "", commentFrozen}},
+		"keep screened": {true, []string{"", "", commentDeleted, "", commentScreened, commentFrozen}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := testConverter(t, func(o *Options) { o.LJScreened = tc.keep })
+			pages, err := c.loadLJXML(filepath.Join("testdata", "ljdump", "L-664"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wm struct {
+				Children []mention `json:"children"`
+			}
+			if err := json.Unmarshal(pages[0].webmentions(), &wm); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range wm.Children {
+				got = append(got, m.State)
+				if m.State == commentDeleted && (m.Author.Name != "" || m.Content.Html != "") {
+					t.Errorf("want an empty placeholder, got %v", m)
+				}
+			}
+			assertString(t, strings.Join(tc.want, ","), strings.Join(got, ","))
+		})
+	}
+}
+
+func TestLJBCommentState(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want string
+	}{
+		"normal": {`<table class='talk-comment'><tr><td id='cmtbar1' bgcolor='#c0c0c0'><span class='ljuser'><a></a><a>bmx</a></span>
+			<a href='http://www.livejournal.com/talkscreen.bml?mode=screen&amp;talkid=1'>Screen</a></td></tr></table>`, ""},
+		"screened": {`<table class='talk-comment'><tr><td id='cmtbar2' bgcolor='#d0d0d0'><span class='ljuser'><a></a><a>bmx</a></span>
+			<a href='http://www.livejournal.com/talkscreen.bml?mode=unscreen&amp;talkid=2'>Unscreen</a></td></tr></table>`, commentScreened},
+		"frozen": {`<table class='talk-comment'><tr><td id='cmtbar3' bgcolor='#c0c0c0'><span class='ljuser'><a></a><a>bmx</a></span>
+			<a href='http://www.livejournal.com/talkscreen.bml?mode=unfreeze&amp;talkid=3'>Unfreeze</a></td></tr></table>`, commentFrozen},
+		"deleted": {`<table id='ljcmt4'><tr><td><img src='dot.gif' width='25'></td><td>(Deleted comment)</td></tr></table>`, commentDeleted},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertString(t, tc.want, ljbComment{Selection: d.Find("table")}.state())
+		})
+	}
+}
+
+func TestLJXMLCommentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, fn := range []string{"L-664", "C-664"} {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", "ljdump", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comments := func(c *Converter) int {
+		pages, err := c.loadLJXML(filepath.Join(dir, "L-664"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wm struct {
+			Children []mention `json:"children"`
+		}
+		if b := pages[0].webmentions(); b != nil {
+			if err := json.Unmarshal(b, &wm); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return len(wm.Children)
+	}
+
+	c := testConverter(t)
+	want := comments(c)
+	if want == 0 {
+		t.Fatal("no comments")
+	}
+	if err := os.Remove(filepath.Join(dir, "C-664")); err != nil {
+		t.Fatal(err)
+	}
+	if got := comments(c); got != want {
+		t.Errorf("same converter: want %d cached comments, got %d", want, got)
+	}
+	if got := comments(testConverter(t)); got != 0 {
+		t.Errorf("new converter: want no comments, got %d", got)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"html"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	ljUserIcon = "https://l-stat.livejournal.net/img/userinfo.gif"
+	ljCommIcon = "https://l-stat.livejournal.net/img/community.gif"
+)
+
+// convertLJMarkup replaces LiveJournal-specific tags, both raw and as
+// rendered by LiveJournal, with what Hugo can handle.
+func convertLJMarkup(s *goquery.Selection) {
+	convertLJCuts(s)
+	convertLJUsers(s)
+	convertLJEmbeds(s)
+}
+
+// ljCutText returns the custom "read more" text of the first lj-cut.
+func ljCutText(s *goquery.Selection) string {
+	t, _ := s.Find("lj-cut").First().Attr("text")
+	return t
+}
+
+func convertLJCuts(s *goquery.Selection) {
+	cuts := s.Find("lj-cut")
+	if cuts.Length() > 0 {
+		insertMore(cuts.First())
+	} else {
+		insertMore(s.Find(`a[name^="cutid"]`).First())
+	}
+	cuts.Each(func(_ int, c *goquery.Selection) {
+		c.ReplaceWithSelection(c.Contents())
+	})
+	s.Find(`a[name^="cutid"]`).Remove()
+}
+
+func convertLJUsers(s *goquery.Selection) {
+	// <lj user="..."> is not a void element for the HTML parser, so
+	// whatever follows it ends up inside
+	s.Find("lj").Each(func(_ int, l *goquery.Selection) {
+		l.AfterSelection(l.Contents())
+		name, ok := l.Attr("user")
+		comm := false
+		if !ok {
+			name, comm = l.AttrOr("comm", ""), true
+		}
+		if name == "" {
+			l.Remove()
+			return
+		}
+		l.ReplaceWithHtml(ljUserHtml(name, comm))
+	})
+
+	s.Find(".ljuser").Each(func(_ int, l *goquery.Selection) {
+		name := l.AttrOr("lj:user", strings.TrimSpace(l.Find("a").Last().Text()))
+		if name == "" {
+			return
+		}
+		comm := strings.Contains(l.Find("img").AttrOr("src", ""), "community")
+		l.ReplaceWithHtml(ljUserHtml(name, comm))
+	})
+}
+
+func ljUserHtml(name string, comm bool) string {
+	u, icon := ljUserURL(name, comm), ljUserIcon
+	if comm {
+		icon = ljCommIcon
+	}
+	return `<span class="ljuser"><a href="` + html.EscapeString(u+"profile") +
+		`"><img class="ljuser-icon" src="` + icon + `" alt="[info]"></a><a href="` +
+		html.EscapeString(u) + `"><b>` + html.EscapeString(name) + `</b></a></span>`
+}
+
+// ljUserURL returns the journal URL for the LiveJournal user or
+// community.
+func ljUserURL(name string, comm bool) string {
+	if strings.HasPrefix(name, "_") || strings.HasSuffix(name, "_") {
+		if comm {
+			return "https://community.livejournal.com/" + name + "/"
+		}
+		return "https://users.livejournal.com/" + name + "/"
+	}
+	return "https://" + strings.ReplaceAll(name, "_", "-") + ".livejournal.com/"
+}
+
+// convertLJEmbeds turns the embedded videos into iframes the embed
+// rules recognize.
+func convertLJEmbeds(s *goquery.Selection) {
+	embeds := s.Find("lj-embed, object, embed").FilterFunction(func(_ int, e *goquery.Selection) bool {
+		return e.ParentsFiltered("lj-embed, object").Length() == 0
+	})
+	embeds.Each(func(_ int, e *goquery.Selection) {
+		var src string
+		e.Find("iframe, embed, object, param").AddSelection(e).EachWithBreak(func(_ int, m *goquery.Selection) bool {
+			for _, a := range []string{"src", "data", "value"} {
+				if u := embedURL(m.AttrOr(a, "")); u != "" {
+					src = u
+					return false
+				}
+			}
+			return true
+		})
+		switch {
+		case src != "":
+			e.ReplaceWithHtml(`<iframe src="` + html.EscapeString(src) + `"></iframe>`)
+		case goquery.NodeName(e) == "lj-embed":
+			e.ReplaceWithSelection(e.Contents())
+		}
+	})
+}
+
+func embedURL(u string) string {
+	if m := youtubeRe.FindStringSubmatch(u); m != nil {
+		return "https://www.youtube.com/embed/" + m[1]
+	}
+	if m := vimeoRe.FindStringSubmatch(u); m != nil {
+		return "https://player.vimeo.com/video/" + m[1]
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	ljPublic  = "public"
+	ljFriends = "friends"
+	ljCustom  = "custom"
+	ljPrivate = "private"
+
+	policyPublish = "publish"
+	policyDraft   = "draft"
+	policySkip    = "skip"
+)
+
+// ljSecurityIcons are the icons LiveJournal marks the entries that are
+// not public with.
+var ljSecurityIcons = map[string]string{
+	"icon_protected.gif": ljFriends,
+	"icon_groups.gif":    ljCustom,
+	"icon_private.gif":   ljPrivate,
+}
+
+// ljOptions are the settings the LiveJournal entries are converted with:
+// what to do with the entries of each security level, and whether to
+// keep the screened comments.
+type ljOptions struct {
+	policy       map[string]string
+	keepScreened bool
+}
+
+// parseSecurityPolicy parses the policy for the entries that are not
+// public: either one policy for all of them, like "skip", or a list of
+// levels with their policies, like "friends=draft,private=skip". The
+// levels not in the list are drafted.
+func parseSecurityPolicy(s string) (map[string]string, error) {
+	policy := map[string]string{
+		ljFriends: policyDraft,
+		ljCustom:  policyDraft,
+		ljPrivate: policyDraft,
+	}
+	if !strings.Contains(s, "=") {
+		if !validPolicy(s) {
+			return nil, fmt.Errorf("unknown policy %q", s)
+		}
+		for l := range policy {
+			policy[l] = s
+		}
+		return policy, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("no policy for %q", item)
+		}
+		if _, ok := policy[kv[0]]; !ok {
+			return nil, fmt.Errorf("unknown security level %q", kv[0])
+		}
+		if !validPolicy(kv[1]) {
+			return nil, fmt.Errorf("unknown policy %q", kv[1])
+		}
+		policy[kv[0]] = kv[1]
+	}
+	return policy, nil
+}
+
+func validPolicy(s string) bool {
+	return s == policyPublish || s == policyDraft || s == policySkip
+}
+
+// securityPolicy returns what to do with an entry of the security level;
+// the public ones are always published, the rest are drafted unless the
+// policy says otherwise.
+func (o ljOptions) securityPolicy(level string) string {
+	if level == ljPublic {
+		return policyPublish
+	}
+	if p, ok := o.policy[level]; ok {
+		return p
+	}
+	return policyDraft
+}
+
+// ljSecurityIcon tells the security level the icon stands for, if it's
+// a security icon at all.
+func ljSecurityIcon(src string) (string, bool) {
+	l, ok := ljSecurityIcons[path.Base(src)]
+	return l, ok
+}
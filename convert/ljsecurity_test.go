@@ -0,0 +1,95 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSecurityPolicy(t *testing.T) {
+	tests := map[string]struct {
+		s    string
+		want map[string]string
+	}{
+		"all": {"skip", map[string]string{ljFriends: policySkip, ljCustom: policySkip, ljPrivate: policySkip}},
+		"per level": {"friends=publish, private=skip",
+			map[string]string{ljFriends: policyPublish, ljCustom: policyDraft, ljPrivate: policySkip}},
+		"bad policy": {"hide", nil},
+		"bad level":  {"public=skip", nil},
+		"no policy":  {"friends=draft,private", nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseSecurityPolicy(tc.s)
+			if tc.want == nil {
+				if err == nil {
+					t.Fatalf("want an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLJSecurity(t *testing.T) {
+	tests := map[string]struct {
+		policy string
+		want   string
+		draft  interface{}
+		skip   bool
+	}{
+		"draft":   {"draft", ljFriends, true, false},
+		"publish": {"friends=publish", ljFriends, nil, false},
+		"skip":    {"private=draft,friends=skip", ljFriends, nil, true},
+	}
+
+	fn := filepath.Join("testdata", "ljb_markup.html")
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := testConverter(t, func(o *Options) { o.LJSecurity = tc.policy })
+			p, err := c.loadPage(fn, "ljbackup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.skip {
+				if p != nil {
+					t.Fatal("want the entry skipped")
+				}
+				return
+			}
+			params := pageParams(p)
+			assertString(t, tc.want, params["access"].(string))
+			if params["draft"] != tc.draft {
+				t.Fatalf("want draft %v, got %v", tc.draft, params["draft"])
+			}
+		})
+	}
+
+	s, err := loadHtmlFile(filepath.Join("testdata", "ljb_f.html"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, ljPublic, newLJBPage(s, ljOptions{}).security())
+}
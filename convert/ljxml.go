@@ -0,0 +1,418 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const ljxTimeLayout = "2006-01-02 15:04:05"
+
+// ljxEntry is a LiveJournal entry as ljdump saves it, or as it is in the
+// XML export of the journal. ljdump keeps the properties of the entry
+// under props, the export has them right in the entry.
+type ljxEntry struct {
+	ItemID    int    `xml:"itemid"`
+	Anum      int    `xml:"anum"`
+	Eventtime string `xml:"eventtime"`
+	Subject   string `xml:"subject"`
+	Event     string `xml:"event"`
+	Security  string `xml:"security"`
+	Allowmask uint32 `xml:"allowmask"`
+	Url       string `xml:"url"`
+	ljxProps
+	Props ljxProps `xml:"props"`
+}
+
+type ljxProps struct {
+	Mood         string `xml:"current_mood"`
+	Music        string `xml:"current_music"`
+	Location     string `xml:"current_location"`
+	Taglist      string `xml:"taglist"`
+	Adult        string `xml:"adult_content"`
+	Userpic      string `xml:"picture_keyword"`
+	Preformatted string `xml:"opt_preformatted"`
+}
+
+// ljxComment is a comment as ljdump saves it, or as it is in the
+// comments export; the latter has the IDs as attributes, and the
+// commenters as IDs to look up in the user map.
+type ljxComment struct {
+	ID         int    `xml:"id"`
+	ParentID   int    `xml:"parentid"`
+	IDAttr     int    `xml:"id,attr"`
+	ParentAttr int    `xml:"parentid,attr"`
+	JItemID    int    `xml:"jitemid,attr"`
+	PosterID   int    `xml:"posterid,attr"`
+	User       string `xml:"user"`
+	Subject    string `xml:"subject"`
+	Body       string `xml:"body"`
+	Date       string `xml:"date"`
+	State      string `xml:"state"`
+	StateAttr  string `xml:"state,attr"`
+
+	entry *ljxPage
+}
+
+type ljxUsermap struct {
+	ID   int    `xml:"id,attr"`
+	User string `xml:"user,attr"`
+}
+
+// ljxExport is the XML export of a journal, either of the entries or of
+// the comments.
+type ljxExport struct {
+	Entries  []ljxEntry   `xml:"entry"`
+	Comments []ljxComment `xml:"comments>comment"`
+	Usermaps []ljxUsermap `xml:"usermaps>usermap"`
+}
+
+// ljxPage is a LiveJournal entry from an XML archive.
+type ljxPage struct {
+	entry    ljxEntry
+	sel      *goquery.Selection
+	readMore string
+	comments []ljxComment
+	opts     ljOptions
+}
+
+// ljxCommentCache keeps the comments found in the archive directories,
+// by the entry they belong to, so that every directory is only read once
+// by the converter.
+type ljxCommentCache struct {
+	sync.Mutex
+	m map[string]map[int][]ljxComment
+}
+
+// loadLJXML loads the entries from a file of an XML archive, except for
+// those to skip; the files that only have comments or are not XML at all
+// have no entries.
+func (c *Converter) loadLJXML(fn string) ([]page, error) {
+	root, b, err := readLJXML(fn)
+	if err != nil || root == "" {
+		return nil, err
+	}
+
+	var entries []ljxEntry
+	switch root {
+	case "event":
+		var e ljxEntry
+		if err := decodeLJXML(b, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	case "livejournal":
+		var x ljxExport
+		if err := decodeLJXML(b, &x); err != nil {
+			return nil, err
+		}
+		entries = x.Entries
+	}
+
+	comments := c.ljxComments(filepath.Dir(fn))
+	var pages []page
+	for _, e := range entries {
+		p, err := newLJXPage(e, c.ljOptions())
+		if err != nil {
+			return nil, err
+		}
+		if sec := p.security(); p.opts.securityPolicy(sec) == policySkip {
+			c.log.Info("skipping entry", "file", fn, "security", sec, "url", p.canonicalUrl())
+			continue
+		}
+		for _, cmt := range comments[e.ItemID] {
+			cmt.entry = p
+			p.comments = append(p.comments, cmt)
+		}
+		pages = append(pages, p)
+	}
+	return pages, nil
+}
+
+// readLJXML reads the file and tells the name of its root element, or
+// an empty string if it's not XML.
+func readLJXML(fn string) (string, []byte, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return "", nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("<")) {
+		return "", nil, nil
+	}
+	d := newLJXMLDecoder(b)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", nil, nil
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			return se.Name.Local, b, nil
+		}
+	}
+}
+
+func decodeLJXML(b []byte, v interface{}) error {
+	return newLJXMLDecoder(b).Decode(v)
+}
+
+func newLJXMLDecoder(b []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		e, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return e.NewDecoder().Reader(r), nil
+	}
+	d.Strict = false
+	return d
+}
+
+// ljxComments returns the comments found in the directory, by the entry
+// they belong to. ljdump saves the comments to each entry as C-itemid,
+// the comments export has them all in one file.
+func (c *Converter) ljxComments(dir string) map[int][]ljxComment {
+	c.comments.Lock()
+	defer c.comments.Unlock()
+	if m, ok := c.comments.m[dir]; ok {
+		return m
+	}
+
+	m := map[int][]ljxComment{}
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		fn := filepath.Join(dir, f.Name())
+		root, b, err := readLJXML(fn)
+		if err != nil {
+			c.log.Warn("failed to read", "file", fn, "error", err)
+			continue
+		}
+		switch root {
+		case "comments":
+			id, err := strconv.Atoi(strings.TrimPrefix(f.Name(), "C-"))
+			if err != nil {
+				continue
+			}
+			var x struct {
+				Comments []ljxComment `xml:"comment"`
+			}
+			if err := decodeLJXML(b, &x); err != nil {
+				c.log.Warn("failed to read comments", "file", fn, "error", err)
+				continue
+			}
+			m[id] = append(m[id], x.Comments...)
+		case "livejournal":
+			var x ljxExport
+			if err := decodeLJXML(b, &x); err != nil {
+				c.log.Warn("failed to read comments", "file", fn, "error", err)
+				continue
+			}
+			users := map[int]string{}
+			for _, u := range x.Usermaps {
+				users[u.ID] = u.User
+			}
+			for _, cmt := range x.Comments {
+				cmt.ID, cmt.ParentID, cmt.State = cmt.IDAttr, cmt.ParentAttr, cmt.StateAttr
+				if cmt.User == "" {
+					cmt.User = users[cmt.PosterID]
+				}
+				m[cmt.JItemID] = append(m[cmt.JItemID], cmt)
+			}
+		}
+	}
+	if c.comments.m == nil {
+		c.comments.m = map[string]map[int][]ljxComment{}
+	}
+	c.comments.m[dir] = m
+	return m
+}
+
+func newLJXPage(e ljxEntry, o ljOptions) (*ljxPage, error) {
+	if e.Props != (ljxProps{}) {
+		e.ljxProps = e.Props
+	}
+	body := e.Event
+	if e.Preformatted == "" || e.Preformatted == "0" {
+		body = strings.ReplaceAll(body, "\n", "<br>")
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	p := &ljxPage{entry: e, sel: doc.Find("body"), opts: o}
+	p.readMore = ljCutText(p.sel)
+	convertLJMarkup(p.sel)
+	p.sel.Find("br").ReplaceWithHtml("<p>")
+	return p, nil
+}
+
+// ditemid returns the ID the entry has in its URL.
+func (p *ljxPage) ditemid() int {
+	if p.entry.Anum == 0 {
+		return p.entry.ItemID
+	}
+	return p.entry.ItemID*256 + p.entry.Anum
+}
+
+func (p *ljxPage) canonicalUrl() string {
+	if u, err := url.Parse(p.entry.Url); err == nil && p.entry.Url != "" {
+		return path.Base(u.Path)
+	}
+	return strconv.Itoa(p.ditemid()) + ".html"
+}
+
+func (p *ljxPage) content() pageContent {
+	return pageContent{p.sel}
+}
+
+func (p *ljxPage) date() time.Time {
+	dt, _ := time.ParseInLocation(ljxTimeLayout, p.entry.Eventtime, time.Local)
+	return dt
+}
+
+func (p *ljxPage) title() string {
+	return p.entry.Subject
+}
+
+func (p *ljxPage) tags() []string {
+	var tags []string
+	for _, t := range strings.Split(p.entry.Taglist, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// security returns the security level of the entry; the mask of the
+// friends-only entries is 1, anything else is a custom group.
+func (p *ljxPage) security() string {
+	switch p.entry.Security {
+	case "private":
+		return ljPrivate
+	case "usemask":
+		if p.entry.Allowmask == 1 {
+			return ljFriends
+		}
+		return ljCustom
+	}
+	return ljPublic
+}
+
+func (p *ljxPage) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if p.readMore != "" {
+		params["read_more"] = p.readMore
+	}
+	lj := map[string]string{}
+	for k, v := range map[string]string{
+		"mood":            p.entry.Mood,
+		"music":           p.entry.Music,
+		"location":        p.entry.Location,
+		"userpic_keyword": p.entry.Userpic,
+	} {
+		if v != "" {
+			lj[k] = v
+		}
+	}
+	if a := p.entry.Adult; a != "" && a != "none" {
+		lj["adult"] = a
+	}
+	if len(lj) > 0 {
+		params["lj"] = lj
+	}
+	if sec := p.security(); sec != ljPublic {
+		params["access"] = sec
+		if p.opts.securityPolicy(sec) == policyDraft {
+			params["draft"] = true
+		}
+	}
+	return params
+}
+
+func (p *ljxPage) webmentions() []byte {
+	var cs []ljThreadComment
+	for _, c := range p.comments {
+		cs = append(cs, c)
+	}
+	return ljWebmentions(cs, p.opts.keepScreened)
+}
+
+func (c ljxComment) author() author {
+	if c.User == "" {
+		return author{Type: "card", Name: "anonymous"}
+	}
+	return author{Type: "card", Name: c.User, Url: ljUserURL(c.User, false)}
+}
+
+func (c ljxComment) content() content {
+	var t string
+	if d, err := goquery.NewDocumentFromReader(strings.NewReader(c.Body)); err == nil {
+		t = d.Text()
+	}
+	return content{Text: t, Html: c.Body}
+}
+
+func (c ljxComment) url() string {
+	return c.commentURL(c.ID)
+}
+
+func (c ljxComment) id() string {
+	return strconv.Itoa(c.ID)
+}
+
+func (c ljxComment) parentID() string {
+	return strconv.Itoa(c.ParentID)
+}
+
+func (c ljxComment) state() string {
+	return ljCommentState(c.State)
+}
+
+// commentURL returns the URL of the comment with the ID, the way
+// LiveJournal makes it of the entry URL. The export has no entry URLs,
+// so only the IDs of the comments are there to keep the threads.
+func (c ljxComment) commentURL(id int) string {
+	if c.entry == nil || c.entry.entry.Url == "" {
+		return "#comment" + strconv.Itoa(id)
+	}
+	t := strconv.Itoa(id*256 + c.entry.entry.Anum)
+	return c.entry.entry.Url + "?thread=" + t + "#t" + t
+}
+
+func (c ljxComment) date() string {
+	d, err := time.Parse(time.RFC3339, c.Date)
+	if err != nil {
+		d, _ = time.ParseInLocation(ljxTimeLayout, c.Date, time.Local)
+	}
+	return d.In(time.Local).String()
+}
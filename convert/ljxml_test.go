@@ -0,0 +1,73 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLJXML(t *testing.T) {
+	tests := map[string]struct {
+		file string
+		url  string
+		want string
+	}{
+		"ljdump":         {filepath.Join("ljdump", "L-664"), "170041.html", "ljdump"},
+		"export private": {filepath.Join("ljexport", "2008-11.xml"), "663.html", "ljexport_663"},
+		"export":         {filepath.Join("ljexport", "2008-11.xml"), "665.html", "ljexport_665"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := testConverter(t)
+			pages, err := c.loadLJXML(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p page
+			for _, pg := range pages {
+				if pg.canonicalUrl() == tc.url {
+					p = pg
+				}
+			}
+			if p == nil {
+				t.Fatalf("no %s in %d entries", tc.url, len(pages))
+			}
+			_, got := mustHugo(t, c, p)
+			assertGolden(t, got, filepath.Join("testdata", tc.want+".md"))
+			if wm := p.webmentions(); wm != nil {
+				assertGolden(t, wm, filepath.Join("testdata", tc.want+".json"))
+			}
+		})
+	}
+}
+
+func TestLJXMLNoEntries(t *testing.T) {
+	for _, fn := range []string{
+		filepath.Join("ljdump", "C-664"),
+		filepath.Join("ljexport", "comments.xml"),
+		"gp_takeout.jpg",
+	} {
+		pages, err := testConverter(t).loadLJXML(filepath.Join("testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 0 {
+			t.Fatalf("%s: want no entries, got %d", fn, len(pages))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is how important a log record is.
+type Level int
+
+// The levels of the log records.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level" + strconv.Itoa(int(l))
+}
+
+// The formats of the log.
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// Logger writes the log records of the level it's set to and above, one
+// line each, as text or as JSON. It's safe to use from many goroutines.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+	now   func() time.Time
+}
+
+// NewLogger returns the Logger writing the records of the level and
+// above to w in the format, LogText or LogJSON.
+func NewLogger(w io.Writer, level Level, format string) (*Logger, error) {
+	l := &Logger{w: w, level: level, now: time.Now}
+	switch format {
+	case LogText:
+	case LogJSON:
+		l.json = true
+	default:
+		return nil, fmt.Errorf("%s: unknown log format", format)
+	}
+	return l, nil
+}
+
+// defaultLogger is the log the conversion writes to if the options have
+// no Logger.
+var defaultLogger = &Logger{w: os.Stderr, level: LevelInfo, now: time.Now}
+
+// Debug logs the message with the key-value pairs at LevelDebug.
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+// Info logs the message with the key-value pairs at LevelInfo.
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+// Warn logs the message with the key-value pairs at LevelWarn.
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+// Error logs the message with the key-value pairs at LevelError.
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+	if len(kv)%2 != 0 {
+		kv = append(kv, "!MISSING")
+	}
+	t := l.now().Format(time.RFC3339)
+
+	var b bytes.Buffer
+	if l.json {
+		b.WriteString(`{"time":`)
+		writeJSON(&b, t)
+		b.WriteString(`,"level":`)
+		writeJSON(&b, level.String())
+		b.WriteString(`,"msg":`)
+		writeJSON(&b, msg)
+		for i := 0; i < len(kv); i += 2 {
+			b.WriteByte(',')
+			writeJSON(&b, fmt.Sprint(kv[i]))
+			b.WriteByte(':')
+			writeJSON(&b, logValue(kv[i+1]))
+		}
+		b.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&b, "%s %-5s %s", t, strings.ToUpper(level.String()), msg)
+		for i := 0; i < len(kv); i += 2 {
+			fmt.Fprintf(&b, " %v=%s", kv[i], quoteValue(fmt.Sprint(logValue(kv[i+1]))))
+		}
+		b.WriteByte('\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(b.Bytes())
+}
+
+// logValue makes the errors strings, so that they are logged as their
+// messages in JSON, too.
+func logValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(j)
+}
+
+// quoteValue quotes the value of a text record if it can't be told from
+// the rest of the line otherwise.
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Progress is how far the conversion has got.
+type Progress struct {
+	// Discovered is the number of posts found to convert.
+	Discovered int64
+	// Processed is the number of posts converted and saved.
+	Processed int64
+	// Failed is the number of posts that failed to convert.
+	Failed int64
+	// Assets is the number of the images and the files downloaded.
+	Assets int64
+}
+
+func (p *Progress) load() Progress {
+	return Progress{
+		Discovered: atomic.LoadInt64(&p.Discovered),
+		Processed:  atomic.LoadInt64(&p.Processed),
+		Failed:     atomic.LoadInt64(&p.Failed),
+		Assets:     atomic.LoadInt64(&p.Assets),
+	}
+}
+
+// logFailures logs the failures and adds the posts that failed to the
+// progress; an image or a file that couldn't be downloaded doesn't fail
+// the post.
+func (c *Converter) logFailures(errs []*ItemError) {
+	for _, err := range errs {
+		if err.Stage == StageAsset {
+			c.log.Warn("failed to fetch asset", "item", err.Item, "error", err.Err)
+			continue
+		}
+		c.log.Error("failed", "item", err.Item, "stage", err.Stage, "error", err.Err)
+		atomic.AddInt64(&c.stats.Failed, 1)
+	}
+}
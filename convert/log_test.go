@@ -0,0 +1,64 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		level  Level
+		want   string
+	}{
+		"text": {LogText, LevelInfo, `2020-05-01T10:00:00Z INFO  processing url=https://example.site/post
+2020-05-01T10:00:00Z ERROR failed item=L-1 stage=load error="bad date"
+`},
+		"json": {LogJSON, LevelDebug, `{"time":"2020-05-01T10:00:00Z","level":"debug","msg":"fetched asset","n":1}
+{"time":"2020-05-01T10:00:00Z","level":"info","msg":"processing","url":"https://example.site/post"}
+{"time":"2020-05-01T10:00:00Z","level":"error","msg":"failed","item":"L-1","stage":"load","error":"bad date"}
+`},
+		"quiet": {LogText, LevelWarn, `2020-05-01T10:00:00Z ERROR failed item=L-1 stage=load error="bad date"
+`},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			l, err := NewLogger(&b, tc.level, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.now = func() time.Time { return time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+			l.Debug("fetched asset", "n", 1)
+			l.Info("processing", "url", "https://example.site/post")
+			l.Error("failed", "item", "L-1", "stage", StageLoad, "error", errors.New("bad date"))
+			if got := b.String(); got != tc.want {
+				t.Fatalf("want:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := NewLogger(&bytes.Buffer{}, LevelInfo, "xml"); err == nil {
+		t.Error("want an error for an unknown format")
+	}
+}
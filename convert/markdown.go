@@ -0,0 +1,338 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const asciiPunct = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+var (
+	spaceRe       = regexp.MustCompile(`[ \t\r\n]+`)
+	entityRe      = regexp.MustCompile(`^&(?:#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+	listItemRe    = regexp.MustCompile(`^([*+-])(?:[ \t]|$)`)
+	orderedItemRe = regexp.MustCompile(`^([0-9]{1,9})([.)])(?:[ \t]|$)`)
+	breakRe       = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:_[ \t]*){3,}|(?:-[ \t]*){3,}|=+[ \t]*)$`)
+)
+
+// textRule replaces the html-to-markdown's own text rule that escapes
+// every character that might have a meaning in markdown, and then some.
+var textRule = md.Rule{
+	Filter: []string{"#text"},
+	Replacement: func(_ string, s *goquery.Selection, _ *md.Options) *string {
+		n := s.Get(0)
+		text := n.Data
+		if inCode(n) {
+			return &text
+		}
+
+		if strings.TrimSpace(text) == "" {
+			switch {
+			case strings.ContainsRune(text, '\u00a0'):
+				text = strings.Trim(text, " \t\r\n")
+			case isInline(n.PrevSibling) && isInline(n.NextSibling):
+				text = " "
+			default:
+				text = ""
+			}
+			return &text
+		}
+
+		text = spaceRe.ReplaceAllString(text, " ")
+		start := startsLine(n)
+		if start {
+			text = strings.TrimLeft(text, " ")
+		}
+		text = escapeText(text, start)
+		return &text
+	},
+}
+
+// moreRule keeps the Hugo summary divider.
+var moreRule = md.Rule{
+	Filter: []string{"#comment"},
+	Replacement: func(_ string, s *goquery.Selection, _ *md.Options) *string {
+		if strings.TrimSpace(s.Get(0).Data) != "more" {
+			return md.String("")
+		}
+		return md.String("\n\n<!--more-->\n\n")
+	},
+}
+
+// insertMore puts the Hugo summary divider before the selection, unless
+// there is one already.
+func insertMore(s *goquery.Selection) {
+	if s.Length() == 0 || hasMore(s.Closest("html, body")) {
+		return
+	}
+	s.First().BeforeNodes(&html.Node{Type: html.CommentNode, Data: "more"})
+}
+
+func hasMore(s *goquery.Selection) bool {
+	found := false
+	for _, n := range s.Nodes {
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.CommentNode && strings.TrimSpace(n.Data) == "more" {
+				found = true
+			}
+			for c := n.FirstChild; c != nil && !found; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(n)
+	}
+	return found
+}
+
+// detailsRule turns the collapsible blocks into the Hugo "details"
+// shortcode.
+var detailsRule = md.Rule{
+	Filter: []string{"details"},
+	Replacement: func(content string, s *goquery.Selection, _ *md.Options) *string {
+		summary := plainText(s.ChildrenFiltered("summary").First())
+		return block(fmt.Sprintf("{{< details summary=%q >}}\n\n%s\n\n{{< /details >}}", summary, strings.TrimSpace(content)))
+	},
+}
+
+// summaryRule drops the summary of a details block, since detailsRule
+// puts it into the shortcode.
+var summaryRule = md.Rule{
+	Filter: []string{"summary"},
+	Replacement: func(_ string, s *goquery.Selection, _ *md.Options) *string {
+		if s.ParentFiltered("details").Length() == 0 {
+			return nil
+		}
+		return md.String("")
+	},
+}
+
+// brRule makes line breaks hard line breaks, rather than dropping them.
+var brRule = md.Rule{
+	Filter: []string{"br"},
+	Replacement: func(_ string, _ *goquery.Selection, _ *md.Options) *string {
+		return md.String("  \n")
+	},
+}
+
+// emRule converts emphasis, which html-to-markdown doesn't, with the
+// delimiter that also works inside words.
+var emRule = md.Rule{
+	Filter: []string{"em", "i"},
+	Replacement: func(content string, _ *goquery.Selection, _ *md.Options) *string {
+		return md.String(emphasize(content, "*"))
+	},
+}
+
+// strongRule replaces the html-to-markdown's one that doesn't know
+// bold text can span several paragraphs in HTML.
+var strongRule = md.Rule{
+	Filter: []string{"strong", "b"},
+	Replacement: func(content string, _ *goquery.Selection, _ *md.Options) *string {
+		return md.String(emphasize(content, "**"))
+	},
+}
+
+// emphasize wraps every paragraph of the content in the delimiters,
+// keeping the surrounding whitespace outside.
+func emphasize(content, delim string) string {
+	paras := strings.Split(content, "\n\n")
+	for i, p := range paras {
+		t := strings.TrimSpace(p)
+		if t == "" {
+			continue
+		}
+		lead := p[:strings.Index(p, t)]
+		trail := p[len(lead)+len(t):]
+		paras[i] = lead + delim + t + delim + trail
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// escapeText escapes the characters in the text that would otherwise be
+// interpreted as markdown by a CommonMark parser such as Goldmark.
+func escapeText(text string, lineStart bool) string {
+	var b strings.Builder
+	if lineStart {
+		text = escapeLineStart(&b, text)
+	}
+
+	tildes := strings.Count(text, "~") > 1
+	for i, r := range text {
+		prev, _ := utf8.DecodeLastRuneInString(text[:i])
+		next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+
+		switch r {
+		case '\\':
+			if strings.ContainsRune(asciiPunct, next) {
+				b.WriteRune('\\')
+			}
+		case '`':
+			b.WriteRune('\\')
+		case '*':
+			if !(isSpace(prev) && isSpace(next)) {
+				b.WriteRune('\\')
+			}
+		case '_':
+			if !(isSpace(prev) && isSpace(next)) && !(isAlnum(prev) && isAlnum(next)) {
+				b.WriteRune('\\')
+			}
+		case ']':
+			if next == '(' || next == '[' || next == ':' {
+				b.WriteRune('\\')
+			}
+		case '<':
+			if next == '/' || next == '!' || next == '?' || next < utf8.RuneSelf && unicode.IsLetter(next) {
+				b.WriteRune('\\')
+			}
+		case '&':
+			if entityRe.MatchString(text[i:]) {
+				b.WriteRune('\\')
+			}
+		case '~':
+			if tildes {
+				b.WriteRune('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeLineStart writes the beginning of the text escaping whatever
+// would start a block there, and returns the rest of the text.
+func escapeLineStart(b *strings.Builder, text string) string {
+	switch {
+	case breakRe.MatchString(text) && (text[0] == '-' || text[0] == '='):
+		// * and _ are escaped anyway
+		b.WriteRune('\\')
+	case strings.HasPrefix(text, "#"):
+		h := strings.TrimLeft(text, "#")
+		if len(text)-len(h) <= 6 && (h == "" || h[0] == ' ' || h[0] == '\t') {
+			b.WriteRune('\\')
+		}
+	case strings.HasPrefix(text, ">"):
+		b.WriteRune('\\')
+	case listItemRe.MatchString(text) && text[0] != '*':
+		b.WriteRune('\\')
+	case orderedItemRe.MatchString(text):
+		m := orderedItemRe.FindStringSubmatch(text)
+		b.WriteString(m[1])
+		b.WriteRune('\\')
+		return text[len(m[1]):]
+	}
+	return text
+}
+
+// cleanMarkdown removes the empty paragraphs and the excessive blank
+// lines from the markdown, leaving the code blocks alone.
+func cleanMarkdown(s string) string {
+	var out []string
+	fenced := false
+	blank := true
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "```") || strings.HasPrefix(l, "~~~") {
+			fenced = !fenced
+		}
+		if fenced || strings.HasPrefix(l, "    ") || strings.HasPrefix(l, "\t") {
+			out = append(out, l)
+			blank = false
+			continue
+		}
+		if strings.TrimFunc(l, unicode.IsSpace) == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		t := strings.TrimRight(l, " \t")
+		if strings.HasSuffix(l, "  ") && !nextBlank(lines, i) {
+			t += "  "
+		}
+		out = append(out, t)
+		blank = false
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
+// nextBlank tells whether the line after the i-th one is blank, or there
+// is none.
+func nextBlank(lines []string, i int) bool {
+	return i+1 >= len(lines) || strings.TrimFunc(lines[i+1], unicode.IsSpace) == ""
+}
+
+func inCode(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && (p.Data == "code" || p.Data == "pre") {
+			return true
+		}
+	}
+	return false
+}
+
+func isInline(n *html.Node) bool {
+	if n == nil {
+		return false
+	}
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data) != ""
+	}
+	return n.Type == html.ElementNode && md.IsInlineElement(n.Data) && n.Data != "br"
+}
+
+// startsLine tells whether the text node is going to be at the start of
+// a line in the resulting markdown.
+func startsLine(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+			switch {
+			case p.Type == html.ElementNode && p.Data == "br":
+				return true
+			case p.Type == html.ElementNode && !md.IsInlineElement(p.Data):
+				return true
+			case p.Type == html.ElementNode:
+				return false
+			case p.Type == html.TextNode && strings.TrimSpace(p.Data) != "":
+				return false
+			}
+		}
+		if p := n.Parent; p == nil || p.Type != html.ElementNode || !md.IsInlineElement(p.Data) {
+			return true
+		}
+	}
+	return true
+}
+
+// isSpace tells whether the rune is a whitespace; the edges of the text
+// are not, since we don't know what is there.
+func isSpace(r rune) bool {
+	return r != utf8.RuneError && unicode.IsSpace(r)
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var roundTripCases = map[string]string{
+	"dashes":      `<p>рода - отклонение, всё-таки -- да</p><p>- не список</p><p>1. не список, но глава 1. да</p>`,
+	"emphasis":    `<p>a * b, 2*3*4, snake_case, _under_, <b>bold</b> <i>italic</i>&nbsp;<b>x</b></p>`,
+	"brackets":    `<p>[1] сноска, [a](b) и [c]: d, ![e]</p>`,
+	"blocks":      `<p># не заголовок</p><p>&gt; не цитата</p><p>***</p><p>text<br>=====</p>`,
+	"html":        `<p>&lt;b&gt;not bold&lt;/b&gt; &amp;amp; &lt;http://x.y&gt;</p>`,
+	"code":        `<p>use <code>a_b*c</code> and \* and ~~not strike~~</p>`,
+	"typography":  `<p>«Ёлки»&nbsp;— это ёлки,</p><p>&nbsp;</p><p></p><p>а 2&nbsp;000 рублей&nbsp;— деньги…</p>`,
+	"line breaks": `<p>one<br>two<br><br>three</p><div>four<p><p><p>five</div>`,
+	"quote":       `<blockquote><p>- a</p><p>b</p></blockquote><ul><li>- c</li><li>1) d</li></ul>`,
+}
+
+// roundTripElements are the formatting compared between the source and
+// the rendered markdown.
+var roundTripElements = map[string]string{
+	"emphasis": "em, i",
+	"strong":   "strong, b",
+	"headings": "h1, h2, h3, h4, h5, h6",
+	"lists":    "li",
+	"quotes":   "blockquote",
+	"links":    "a[href]",
+	"images":   "img",
+	"code":     "code",
+	"breaks":   "hr",
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	for name, h := range roundTripCases {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(h))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRoundTrip(t, pageContent{d.Find("body")})
+		})
+	}
+
+	for _, f := range []string{"diary_comments.htm", "diary_pic.htm", "ljbackup.html", "ljb_f.html", "gp1.html", "gp2.html"} {
+		t.Run(f, func(t *testing.T) {
+			s, err := loadHtmlFile(filepath.Join("testdata", f), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p page
+			switch filepath.Ext(f) {
+			case ".htm":
+				p = diaryPage{s}
+			default:
+				if strings.HasPrefix(f, "gp") {
+					p = gpPage{s}
+				} else {
+					p = newLJBPage(s, ljOptions{})
+				}
+			}
+			assertRoundTrip(t, p.content())
+		})
+	}
+}
+
+func TestCleanMarkdown(t *testing.T) {
+	tests := map[string]struct {
+		in, want string
+	}{
+		"blank lines":  {"a\n\n\n\nb\n\n", "a\n\nb"},
+		"empty paras":  {"a\n\n \n\n \n\nb", "a\n\nb"},
+		"hard break":   {"a  \nb  \n\nc   ", "a  \nb\n\nc"},
+		"code":         {"a\n\n    x  \n\n\n\n    y\n\n```\n\n\n```", "a\n\n    x  \n\n    y\n\n```\n\n\n```"},
+		"nbsp in text": {"2 000 рублей — деньги", "2 000 рублей — деньги"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertString(t, tc.want, cleanMarkdown(tc.in))
+		})
+	}
+}
+
+func assertRoundTrip(t *testing.T, c pageContent) {
+	t.Helper()
+	src := c.Clone()
+	src.Find("script, style").Remove()
+
+	m := c.md(allEmbeds())
+	var buf bytes.Buffer
+	gm := goldmark.New(goldmark.WithExtensions(extension.Table, extension.Strikethrough))
+	if err := gm.Convert(m, &buf); err != nil {
+		t.Fatal(err)
+	}
+	d, err := goquery.NewDocumentFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := d.Find("body")
+
+	if w, g := strip(src.Text()), strip(got.Text()); w != g {
+		t.Fatalf("text changed:\nwant: %s\ngot:  %s\nmarkdown:\n%s", w, g, m)
+	}
+	for name, sel := range roundTripElements {
+		if w, g := formatted(src, sel), formatted(got, sel); w != g {
+			t.Fatalf("%s changed:\nwant: %s\ngot:  %s\nmarkdown:\n%s", name, w, g, m)
+		}
+	}
+}
+
+// formatted returns what is formatted with the elements: their text, or
+// just their number for those that have none.
+func formatted(s *goquery.Selection, sel string) string {
+	var out string
+	s.Find(sel).Each(func(_ int, e *goquery.Selection) {
+		if e.Is("img, hr") {
+			out += "|"
+			return
+		}
+		if e.ParentsFiltered(sel).Length() == 0 {
+			out += strip(e.Text())
+		}
+	})
+	return out
+}
+
+func strip(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
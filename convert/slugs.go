@@ -0,0 +1,208 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	slugKeep     = "keep"
+	slugGOST     = "gost"
+	slugPassport = "passport"
+	slugID       = "id"
+)
+
+var (
+	idRe      = regexp.MustCompile(`^[a-z]?\d+`)
+	hyphensRe = regexp.MustCompile(`-{2,}`)
+)
+
+// gostTable is GOST 7.79-2000 system B with the apostrophes dropped, as
+// recommended for URLs.
+var gostTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "x", 'ц': "cz", 'ч': "ch", 'ш': "sh", 'щ': "shh", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+}
+
+// passportTable is the ICAO Doc 9303 transliteration used in the Russian
+// passports since 2014.
+var passportTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'і': "i", 'ї': "i", 'є': "ie", 'ґ': "g", 'ў': "u",
+}
+
+// latinTable is the Latin letters that have no accents to drop, but are
+// not ASCII either.
+var latinTable = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'þ': "th", 'ı': "i",
+}
+
+// checkSlugs returns an error if the slug strategy is not one there is.
+func checkSlugs(strategy string) error {
+	switch strategy {
+	case "", slugKeep, slugGOST, slugPassport, slugID:
+		return nil
+	}
+	return fmt.Errorf("%s: unknown slug strategy", strategy)
+}
+
+// slugPage is a page saved under a slug other than the one it had, with
+// the old one kept as an alias.
+type slugPage struct {
+	page
+	alias string
+}
+
+func (p slugPage) files() map[string]string {
+	return pageFiles(p.page)
+}
+
+func (p slugPage) localFiles() map[string]string {
+	return pageLocalFiles(p.page)
+}
+
+func (p slugPage) params() map[string]interface{} {
+	params := pageParams(p.page)
+	aliases, _ := params["aliases"].([]string)
+	params["aliases"] = append(aliases, p.alias)
+	return params
+}
+
+// idPage is a page that has an ID other than the one its slug starts
+// with.
+type idPage interface {
+	id() string
+}
+
+// pageID returns the ID of the page, if it has one of its own.
+func pageID(p page) string {
+	if ip, ok := p.(idPage); ok {
+		return ip.id()
+	}
+	return ""
+}
+
+func (p slugPage) id() string {
+	return pageID(p.page)
+}
+
+// withSlug applies the slug strategy to the slug the page would be saved
+// under, and keeps the slug it had in the source as an alias.
+func (c *Converter) withSlug(p page, orig, slug string) (page, string) {
+	id := pageID(p)
+	if id == "" {
+		id = idRe.FindString(orig)
+	}
+	if id == "" {
+		id = orig
+	}
+	slug = makeSlug(c.opts.Slugs, slug, id)
+	if slug == orig {
+		return p, slug
+	}
+	// relative aliases are on the same level as the page itself
+	return slugPage{page: p, alias: orig}, slug
+}
+
+// makeSlug returns the slug according to the slug strategy.
+func makeSlug(strategy, slug, id string) string {
+	switch strategy {
+	case slugGOST, slugPassport:
+		table := gostTable
+		if strategy == slugPassport {
+			table = passportTable
+		}
+		if t := transliterate(slug, table); t != "" {
+			return t
+		}
+		if id != "" {
+			return id
+		}
+	case slugID:
+		if id != "" {
+			return id
+		}
+	}
+	return slug
+}
+
+// transliterate makes the slug lowercase ASCII: the Cyrillic letters are
+// transliterated with the table, the accents are dropped from the Latin
+// ones, the dashes, the spaces and the underscores become hyphens (one at
+// a time), and whatever else there is, like CJK, quotes or punctuation,
+// is dropped.
+func transliterate(s string, table map[rune]string) string {
+	var b strings.Builder
+	rs := []rune(norm.NFC.String(s))
+	for i, r := range rs {
+		l := unicode.ToLower(r)
+		t, ok := table[l]
+		if !ok {
+			b.WriteString(foldLatin(l))
+			continue
+		}
+		// GOST has "c" rather than "cz" before i, e, y and j
+		if l == 'ц' && t == "cz" && i+1 < len(rs) {
+			if n := table[unicode.ToLower(rs[i+1])]; n != "" && strings.ContainsAny(n[:1], "eijy") {
+				t = "c"
+			}
+		}
+		b.WriteString(t)
+	}
+	return strings.Trim(hyphensRe.ReplaceAllString(b.String(), "-"), "-")
+}
+
+// foldLatin returns the lowercase rune if it's a Latin letter or a
+// digit, with the accents dropped, a hyphen for a dash, a space or an
+// underscore, or nothing.
+func foldLatin(r rune) string {
+	switch {
+	case unicode.IsSpace(r), unicode.Is(unicode.Pd, r), r == '_':
+		return "-"
+	case slugRune(r):
+		return string(r)
+	}
+	if t, ok := latinTable[r]; ok {
+		return t
+	}
+	var b strings.Builder
+	for _, d := range norm.NFD.String(string(r)) {
+		if slugRune(d) {
+			b.WriteRune(d)
+		}
+	}
+	return b.String()
+}
+
+// slugRune tells whether the rune is one of [a-z0-9], the only ones a
+// transliterated slug has besides the hyphens.
+func slugRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+}
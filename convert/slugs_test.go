@@ -0,0 +1,90 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMakeSlug(t *testing.T) {
+	tests := map[string]struct {
+		strategy string
+		slug     string
+		id       string
+		want     string
+	}{
+		"keep":           {slugKeep, "двигаться-дальше", "170041", "двигаться-дальше"},
+		"gost":           {slugGOST, "двигаться-дальше", "", "dvigatsya-dalshe"},
+		"gost cz":        {slugGOST, "цапля-и-цирк", "", "czaplya-i-cirk"},
+		"gost shh":       {slugGOST, "щётка-объёма-эха", "", "shhyotka-obyoma-exa"},
+		"passport":       {slugPassport, "двигаться-дальше", "", "dvigatsia-dalshe"},
+		"passport more":  {slugPassport, "щётка-объёма-хор-цирк", "", "shchetka-obieema-khor-tsirk"},
+		"latin":          {slugGOST, "hugo-2020", "", "hugo-2020"},
+		"mixed":          {slugGOST, "«café»-über-Straße-и-東京–łódź", "", "cafe-uber-strasse-i-lodz"},
+		"punctuation":    {slugGOST, `Привет, "мир"? 100%`, "", "privet-mir-100"},
+		"mixed case":     {slugPassport, "Hugo и Known: How-To", "", "hugo-i-known-how-to"},
+		"ascii only":     {slugGOST, "What's new?! (2020_03)", "", "whats-new-2020-03"},
+		"passport mixed": {slugPassport, "crème-brûlée-по-русски", "", "creme-brulee-po-russki"},
+		"nothing left":   {slugGOST, "東京", "170041", "170041"},
+		"id":             {slugID, "двигаться-дальше", "20200317195816", "20200317195816"},
+		"no id":          {slugID, "двигаться-дальше", "", "двигаться-дальше"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertString(t, tc.want, makeSlug(tc.strategy, tc.slug, tc.id))
+		})
+	}
+}
+
+func TestWithSlug(t *testing.T) {
+	s, err := loadHtmlFile(filepath.Join("testdata", "diary_pic.htm"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := diaryPage{s}
+
+	c := testConverter(t, func(o *Options) { o.Slugs = slugID })
+	got, slug := c.withSlug(p, "p1225644_nachdenklichkeit", "p1225644_nachdenklichkeit")
+	assertString(t, "p1225644", slug)
+	aliases, _ := got.(paramsPage).params()["aliases"].([]string)
+	if len(aliases) != 1 || aliases[0] != "p1225644_nachdenklichkeit" {
+		t.Fatalf("want the old slug as an alias, got %v", aliases)
+	}
+
+	c = testConverter(t, func(o *Options) { o.Slugs = slugKeep })
+	got, _ = c.withSlug(p, "p1225644_nachdenklichkeit", "p1225644_nachdenklichkeit")
+	if _, ok := got.(slugPage); ok {
+		t.Fatal("want the page unchanged")
+	}
+}
+
+func TestKnownSlug(t *testing.T) {
+	s := loadHtml(t, filepath.Join("testdata", "tired.html"))
+
+	c := testConverter(t, func(o *Options) { o.Slugs = slugGOST })
+	p, err := c.newKnownPage(s, getPermalink(s), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, slug := c.withSlug(p, p.canonicalUrl(), p.canonicalUrl())
+	assertString(t, "dvigatsya-dalshe", slug)
+
+	c = testConverter(t, func(o *Options) { o.Slugs = slugID })
+	_, slug = c.withSlug(p, p.canonicalUrl(), p.canonicalUrl())
+	assertString(t, "20200317195816", slug)
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	summaryLength     = 300
+	descriptionLength = 160
+)
+
+// addSummary puts the summary and the description made of the text
+// into the front matter.
+func addSummary(fm map[string]interface{}, text string, cut bool) {
+	if text == "" {
+		return
+	}
+	summary := text
+	if !cut {
+		summary = truncateSentences(text, summaryLength)
+	}
+	fm["summary"] = summary
+	fm["description"] = truncateSentences(summary, descriptionLength)
+}
+
+// leadText returns the plain text of the content up to the summary
+// divider, or the whole text if there is none.
+func leadText(c pageContent) (string, bool) {
+	s := c.Clone()
+	s.Find("script, style, iframe").Remove()
+	cut := false
+	for _, n := range s.Nodes {
+		if m := findMore(n); m != nil {
+			cutAfter(m, n)
+			cut = true
+			break
+		}
+	}
+	return plainText(s), cut
+}
+
+func findMore(n *html.Node) *html.Node {
+	if n.Type == html.CommentNode && strings.TrimSpace(n.Data) == "more" {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if m := findMore(c); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// cutAfter removes everything that follows the node up to the end of
+// the root.
+func cutAfter(n, root *html.Node) {
+	for ; n != nil && n != root; n = n.Parent {
+		for s := n.NextSibling; s != nil; {
+			next := s.NextSibling
+			n.Parent.RemoveChild(s)
+			s = next
+		}
+	}
+}
+
+// truncateSentences shortens the text to at most n characters, cutting
+// it after a sentence if there is one long enough, or between words.
+func truncateSentences(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	r = r[:n]
+	for i := len(r) - 1; i >= n/3; i-- {
+		if strings.ContainsRune(".!?…", r[i]) && (i+1 == len(r) || r[i+1] == ' ') {
+			return string(r[:i+1])
+		}
+	}
+	r = r[:n-1]
+	if i := strings.LastIndex(string(r), " "); i > 0 {
+		return strings.TrimRight(string(r)[:i], ",:;-–— ") + "…"
+	}
+	return string(r) + "…"
+}
+
+// ogSummary returns the page's OpenGraph description unless it's just a
+// link, as Known makes it for some kinds of posts.
+func ogSummary(sel *goquery.Selection) string {
+	d := strings.TrimSpace(openGraph(sel)["og:description"])
+	if !strings.ContainsAny(d, " \t\n") && (strings.HasPrefix(d, "http://") || strings.HasPrefix(d, "https://")) {
+		return ""
+	}
+	return strings.Join(strings.Fields(d), " ")
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestTruncateSentences(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		n    int
+		want string
+	}{
+		"short":    {"Короткий текст.", 20, "Короткий текст."},
+		"sentence": {"Первое предложение. Второе предложение.", 30, "Первое предложение."},
+		"words":    {"Одно очень длинное предложение без точки", 20, "Одно очень длинное…"},
+		"comma":    {"Раз, два, три, четыре", 12, "Раз, два…"},
+		"too soon": {"Да. А вот это уже длинное предложение", 30, "Да. А вот это уже длинное…"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertString(t, tc.want, truncateSentences(tc.text, tc.n))
+		})
+	}
+}
+
+func TestLeadText(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want string
+		cut  bool
+	}{
+		"no divider": {`<p>One <img alt="picture" src="image0"></p><p>Two</p>`, "One Two", false},
+		"divider":    {`<p>One</p><!--more--><p>Two</p>`, "One", true},
+		"nested":     {`<div><p>One</p><div>Two<!--more-->Three</div><p>Four</p></div><p>Five</p>`, "One Two", true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, cut := leadText(pageContent{d.Find("body")})
+			assertString(t, tc.want, got)
+			if cut != tc.cut {
+				t.Fatalf("want cut %v, got %v", tc.cut, cut)
+			}
+		})
+	}
+}
+
+func TestSummaryLJCut(t *testing.T) {
+	s, err := loadHtmlFile(filepath.Join("testdata", "ljb_markup.html"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, cut := leadText(newLJBPage(s, ljOptions{}).content())
+	if !cut {
+		t.Fatal("want the text cut at lj-cut")
+	}
+	fm := map[string]interface{}{}
+	addSummary(fm, text, cut)
+	assertString(t, text, fm["summary"].(string))
+	if len([]rune(fm["description"].(string))) > descriptionLength {
+		t.Fatalf("description too long: %s", fm["description"])
+	}
+}
+
+func TestOgSummary(t *testing.T) {
+	s := loadHtml(t, filepath.Join("testdata", "eter.html"))
+	assertString(t, "", ogSummary(s))
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const titleBlocks = "p, div, br, li, blockquote, h1, h2, h3, h4, h5, h6, tr, figcaption"
+
+var (
+	sentenceRe = regexp.MustCompile(`^(.*?[.!?…])(?:\s|$)`)
+	numericRe  = regexp.MustCompile(`^\d+$`)
+	opaqueRe   = regexp.MustCompile(`^[A-Za-z0-9]{8,}$`)
+)
+
+// titledPage is a page with a title made up for it.
+type titledPage struct {
+	page
+	t string
+}
+
+func (p titledPage) title() string {
+	return p.t
+}
+
+func (p titledPage) files() map[string]string {
+	return pageFiles(p.page)
+}
+
+func (p titledPage) localFiles() map[string]string {
+	return pageLocalFiles(p.page)
+}
+
+func (p titledPage) params() map[string]interface{} {
+	return pageParams(p.page)
+}
+
+func (p titledPage) id() string {
+	return pageID(p.page)
+}
+
+// withTitle returns the page with a title made up for it if it has
+// none, and the slug made from that title if the one it had is opaque.
+func (c *Converter) withTitle(p page, slug string) (page, string) {
+	if !c.opts.AutoTitles || p.title() != "" {
+		return p, slug
+	}
+	t := autoTitle(p.content(), c.opts.TitleWords)
+	if t == "" {
+		return p, slug
+	}
+	if s := slugify(t); s != "" && opaqueSlug(slug) {
+		slug = s
+	}
+	return titledPage{page: p, t: t}, slug
+}
+
+// autoTitle makes up a title from the first sentence of the content,
+// limited to the number of words.
+func autoTitle(c pageContent, words int) string {
+	s := c.Clone()
+	s.Find("script, style, iframe, pre").Remove()
+	s.Find(titleBlocks).AfterHtml("\n")
+	for _, l := range strings.Split(s.Text(), "\n") {
+		l = strings.Join(strings.Fields(l), " ")
+		if l == "" {
+			continue
+		}
+		if m := sentenceRe.FindStringSubmatch(l); m != nil {
+			l = m[1]
+		}
+		return limitWords(l, words)
+	}
+	return ""
+}
+
+func limitWords(s string, n int) string {
+	w := strings.Fields(s)
+	if n > 0 && len(w) > n {
+		return strings.TrimRight(strings.Join(w[:n], " "), ".,:;-–—") + "…"
+	}
+	return strings.TrimRight(s, ".,:;")
+}
+
+// slugify makes a URL-friendly slug of the text the way Known does,
+// keeping the letters of any alphabet.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteRune('-')
+		}
+		dash = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// opaqueSlug tells whether the slug is an ID rather than something a
+// human would read, like LiveJournal's numbers or G+ post IDs.
+func opaqueSlug(s string) bool {
+	if numericRe.MatchString(s) {
+		return true
+	}
+	if !opaqueRe.MatchString(s) {
+		return false
+	}
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0 && strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
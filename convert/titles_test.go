@@ -0,0 +1,97 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestAutoTitle(t *testing.T) {
+	tests := map[string]struct {
+		html  string
+		words int
+		want  string
+	}{
+		"sentence":      {`<p>Short one. And another.</p>`, 10, "Short one"},
+		"question":      {`<p>Is it? Yes.</p>`, 10, "Is it?"},
+		"words":         {`<p>One two three four five six.</p>`, 3, "One two three…"},
+		"markup":        {`<p><b>Bold</b> and <a href="/">link</a></p><p>Second</p>`, 10, "Bold and link"},
+		"line break":    {`First line<br>second line`, 10, "First line"},
+		"empty first":   {`<p> </p><p>Привет, мир!</p>`, 10, "Привет, мир!"},
+		"only an image": {`<p><img src="image0"></p>`, 10, ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := autoTitle(pageContent{d.Find("body")}, tc.words)
+			assertString(t, tc.want, got)
+		})
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Hello, World!":          "hello-world",
+		"Двигаться дальше…":      "двигаться-дальше",
+		"  -- 2020: a year --  ": "2020-a-year",
+	}
+
+	for in, want := range tests {
+		assertString(t, want, slugify(in))
+	}
+}
+
+func TestOpaqueSlug(t *testing.T) {
+	tests := map[string]bool{
+		"170041":                    true,
+		"PGs99nrjdi6":               true,
+		"p1225644_nachdenklichkeit": false,
+		"двигаться-дальше":          false,
+		"something":                 false,
+	}
+
+	for in, want := range tests {
+		if got := opaqueSlug(in); got != want {
+			t.Errorf("%s: want %v, got %v", in, want, got)
+		}
+	}
+}
+
+func TestWithTitle(t *testing.T) {
+	s, err := loadHtmlFile(filepath.Join("testdata", "gp1.html"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gpPage{s}
+
+	c := testConverter(t, func(o *Options) { o.AutoTitles, o.TitleWords = true, 5 })
+	got, slug := c.withTitle(p, p.canonicalUrl())
+	got, slug = c.withSlug(got, p.canonicalUrl(), slug)
+	assertString(t, "О проблему гей-браков сломано такое…", got.title())
+	assertString(t, "о-проблему-гей-браков-сломано-такое", slug)
+	aliases, _ := got.(paramsPage).params()["aliases"].([]string)
+	if len(aliases) != 1 || aliases[0] != "PGs99nrjdi6" {
+		t.Fatalf("want the ID as an alias, got %v", aliases)
+	}
+}
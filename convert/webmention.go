@@ -0,0 +1,340 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	linkRe        = regexp.MustCompile(`(?:\]\(|<|href=")(https?://[^)>"\s]+)[)>"]`)
+	contentFileRe = regexp.MustCompile(`^index(?:\.[\w-]+)?\.(?:md|html)$`)
+)
+
+// wmSender sends webmentions from the generated Hugo bundles to the
+// sites they reply to, like or link.
+type wmSender struct {
+	client  *http.Client
+	dir     string
+	site    string
+	dryRun  bool
+	state   string
+	log     *Logger
+	sent    map[string]string
+	targets map[string]string
+}
+
+// WebmentionOptions are the settings of SendWebmentions.
+type WebmentionOptions struct {
+	// Dir is the directory with the generated bundles.
+	Dir string
+	// Site is the base URL the bundles are published under, like
+	// "https://example.site/posts".
+	Site string
+	// State is the file to keep track of the webmentions already sent
+	// in, so that they are not sent again; nothing is kept if it's not
+	// set.
+	State string
+	// DryRun discovers the endpoints, but doesn't send anything.
+	DryRun bool
+	// Logger is the log of the webmentions sent; the records of LevelInfo
+	// and above go to the standard error if it's not set.
+	Logger *Logger
+}
+
+// SendWebmentions sends the webmentions from the bundles in the
+// directory to the sites they reply to, like or link. The ones that
+// fail are logged and left to send next time.
+func SendWebmentions(o WebmentionOptions) error {
+	if o.Site == "" {
+		return errors.New("no base URL the bundles are published under")
+	}
+	s := newWmSender(o.Dir, o.Site, o.DryRun)
+	if o.Logger != nil {
+		s.log = o.Logger
+	}
+	if o.State != "" {
+		if err := s.loadState(o.State); err != nil {
+			return fmt.Errorf("webmentions sent: %s: %w", o.State, err)
+		}
+	}
+	s.state = o.State
+	s.run()
+	return nil
+}
+
+func newWmSender(dir, site string, dryRun bool) *wmSender {
+	return &wmSender{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		dir:     dir,
+		site:    strings.TrimSuffix(site, "/"),
+		dryRun:  dryRun,
+		log:     defaultLogger,
+		sent:    map[string]string{},
+		targets: map[string]string{},
+	}
+}
+
+func (s *wmSender) loadState(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &s.sent)
+}
+
+// saveState saves the webmentions sent so far; the file is replaced
+// whole, so that it's never left half-written.
+func (s *wmSender) saveState(path string) error {
+	b, err := json.MarshalIndent(s.sent, "", " ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *wmSender) run() {
+	_ = filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			s.log.Warn("failed to read", "file", path, "error", err)
+			return nil
+		}
+		if info.IsDir() || !contentFileRe.MatchString(info.Name()) {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			s.log.Warn("failed to read", "file", path, "error", err)
+			return nil
+		}
+
+		source := s.sourceURL(filepath.Dir(path))
+		for _, target := range bundleTargets(b, s.site) {
+			s.send(source, target)
+		}
+		return nil
+	})
+}
+
+func (s *wmSender) sourceURL(dir string) string {
+	rel, err := filepath.Rel(s.dir, dir)
+	if err != nil {
+		rel = dir
+	}
+	return s.site + "/" + filepath.ToSlash(rel) + "/"
+}
+
+func (s *wmSender) send(source, target string) {
+	key := source + " " + target
+	if _, ok := s.sent[key]; ok {
+		return
+	}
+
+	endpoint, ok := s.targets[target]
+	if !ok {
+		var err error
+		endpoint, err = s.discoverEndpoint(target)
+		if err != nil {
+			s.log.Warn("failed to discover the webmention endpoint", "target", target, "error", err)
+		}
+		s.targets[target] = endpoint
+	}
+	if endpoint == "" {
+		return
+	}
+
+	if s.dryRun {
+		s.log.Info("would send webmention", "source", source, "target", target, "endpoint", endpoint)
+		return
+	}
+
+	if err := s.post(endpoint, source, target); err != nil {
+		s.log.Error("failed to send webmention", "source", source, "target", target, "error", err)
+		return
+	}
+	s.log.Info("sent webmention", "source", source, "target", target)
+	s.sent[key] = time.Now().Format(time.RFC3339)
+	// saved right away, so that an interrupted run doesn't send it again
+	if s.state != "" {
+		if err := s.saveState(s.state); err != nil {
+			s.log.Error("failed to keep track of the webmentions sent", "file", s.state, "error", err)
+		}
+	}
+}
+
+func (s *wmSender) post(endpoint, source, target string) error {
+	res, err := s.client.PostForm(endpoint, url.Values{
+		"source": {source},
+		"target": {target},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	return nil
+}
+
+// discoverEndpoint finds the webmention endpoint of the target as per
+// https://www.w3.org/TR/webmention/#sender-discovers-receiver-webmention-endpoint
+// An empty string with no error means the target doesn't accept webmentions.
+func (s *wmSender) discoverEndpoint(target string) (string, error) {
+	base, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := s.client.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+
+	for _, h := range res.Header["Link"] {
+		if e, ok := linkHeaderEndpoint(h); ok {
+			return resolveURL(base, e), nil
+		}
+	}
+
+	if !strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return "", nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var endpoint string
+	var found bool
+	doc.Find("link[href], a[href]").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		rel, _ := sel.Attr("rel")
+		for _, r := range strings.Fields(rel) {
+			if r == "webmention" {
+				endpoint, _ = sel.Attr("href")
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	if !found {
+		return "", nil
+	}
+	return resolveURL(base, endpoint), nil
+}
+
+func linkHeaderEndpoint(h string) (string, bool) {
+	for _, link := range strings.Split(h, ",") {
+		parts := strings.Split(link, ";")
+		u := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(u, "<") || !strings.HasSuffix(u, ">") {
+			continue
+		}
+		for _, p := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) != 2 || strings.ToLower(kv[0]) != "rel" {
+				continue
+			}
+			for _, r := range strings.Fields(strings.Trim(kv[1], `"`)) {
+				if r == "webmention" {
+					return strings.Trim(u, "<>"), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(u).String()
+}
+
+// bundleTargets returns the external URLs a content file replies to, likes
+// or links, sorted and deduplicated.
+func bundleTargets(b []byte, site string) []string {
+	var fm struct {
+		ReplyTo []string `toml:"reply_to"`
+		LikeOf  string   `toml:"like_of"`
+	}
+
+	body := b
+	parts := bytes.SplitN(b, []byte(frontMatterSeparator), 3)
+	if len(parts) == 3 && len(parts[0]) == 0 {
+		_, _ = toml.Decode(string(parts[1]), &fm)
+		body = parts[2]
+	}
+
+	var own string
+	if su, err := url.Parse(site); err == nil {
+		own = su.Host
+	}
+
+	targets := map[string]struct{}{}
+	add := func(u string) {
+		tu, err := url.Parse(u)
+		if u == "" || err != nil || tu.Host == "" || tu.Host == own {
+			return
+		}
+		targets[u] = struct{}{}
+	}
+	for _, u := range fm.ReplyTo {
+		add(u)
+	}
+	add(fm.LikeOf)
+	for _, m := range linkRe.FindAllSubmatch(body, -1) {
+		add(string(m[1]))
+	}
+
+	var out []string
+	for u := range targets {
+		out = append(out, u)
+	}
+	sort.Strings(out)
+	return out
+}
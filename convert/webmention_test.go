@@ -0,0 +1,135 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBundleTargets(t *testing.T) {
+	b := []byte(frontMatterSeparator + `like_of = "https://habr.com/ru/post/491672/"
+reply_to = ["https://other.site/note/1"]
+title = ""
+` + frontMatterSeparator + `See [this](https://other.site/note/1) and <https://third.site/>, <a href="https://fourth.site/a">html</a>, also [mine](https://example.site/2020/post).`)
+	got := bundleTargets(b, "https://example.site/posts")
+	want := []string{"https://fourth.site/a", "https://habr.com/ru/post/491672/", "https://other.site/note/1", "https://third.site/"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestLinkHeaderEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		"simple":   {`<https://example.site/wm>; rel="webmention"`, "https://example.site/wm", true},
+		"multiple": {`<https://example.site/a>; rel="me", </wm>; rel="other webmention"`, "/wm", true},
+		"unquoted": {`</wm>; rel=webmention`, "/wm", true},
+		"none":     {`<https://example.site/a>; rel="me"`, "", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := linkHeaderEndpoint(tc.header)
+			if ok != tc.ok || got != tc.want {
+				t.Fatalf("want %q (%v), got %q (%v)", tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestSendWebmentions(t *testing.T) {
+	var received []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</endpoint>; rel="webmention"`)
+		fmt.Fprint(w, "<html></html>")
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="webmention" href="/endpoint"></head></html>`)
+	})
+	mux.HandleFunc("/anchor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a rel="webmention" href="endpoint">wm</a></body></html>`)
+	})
+	mux.HandleFunc("/none", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html></html>`)
+	})
+	mux.HandleFunc("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.FormValue("source")+" "+r.FormValue("target"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "known-to-hugo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "2020", "post")
+	if err := os.MkdirAll(bundle, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := []byte(frontMatterSeparator + `reply_to = ["` + ts.URL + `/header"]
+like_of = "` + ts.URL + `/link"
+` + frontMatterSeparator + `[a](` + ts.URL + `/anchor) [b](` + ts.URL + `/none)`)
+	if err := ioutil.WriteFile(filepath.Join(bundle, "index.md"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dry := newWmSender(dir, "https://example.site", true)
+	dry.run()
+	if len(received) != 0 {
+		t.Fatalf("dry run sent %v", received)
+	}
+
+	state := filepath.Join(dir, "state.json")
+	s := newWmSender(dir, "https://example.site/", false)
+	s.state = state
+	s.run()
+	want := []string{
+		"https://example.site/2020/post/ " + ts.URL + "/anchor",
+		"https://example.site/2020/post/ " + ts.URL + "/header",
+		"https://example.site/2020/post/ " + ts.URL + "/link",
+	}
+	if !reflect.DeepEqual(want, received) {
+		t.Fatalf("want %v, got %v", want, received)
+	}
+
+	if err := SendWebmentions(WebmentionOptions{Dir: dir, Site: "https://example.site", State: state}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(want) {
+		t.Fatalf("webmentions sent twice: %v", received)
+	}
+
+	if err := SendWebmentions(WebmentionOptions{Dir: dir, State: state}); err == nil {
+		t.Fatal("want an error for no base URL")
+	}
+}
@@ -6,5 +6,7 @@ require (
 	github.com/BurntSushi/toml v1.2.1
 	github.com/JohannesKaufmann/html-to-markdown v0.0.0-20200323205911-a6f44902a8f4
 	github.com/PuerkitoBio/goquery v1.8.0
+	github.com/yuin/goldmark v1.4.13
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b
 	golang.org/x/text v0.4.0
 )
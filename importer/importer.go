@@ -0,0 +1,210 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+// Package importer is what known-to-hugo needs to know about a source of
+// posts: the pages it has, the comments to them, and how to load them
+// from a local backup.
+//
+// A program that needs known-to-hugo to handle a source it doesn't know
+// registers an Importer for it before the conversion starts, usually in
+// an init function.
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Page is a post to convert.
+type Page interface {
+	Title() string
+	Date() time.Time
+	// Content returns the content of the post. The changes made to it
+	// must stay, as the images are replaced with their local copies
+	// before the content is rendered.
+	Content() *goquery.Selection
+	// CanonicalURL returns the name the post had in the source, which
+	// its slug is made of.
+	CanonicalURL() string
+	Tags() []string
+	// Webmentions returns the comments and reactions to the post as a
+	// JF2 feed, or nil if there are none.
+	Webmentions() []byte
+}
+
+// ParamsPage is a Page that has more to put into the front matter.
+type ParamsPage interface {
+	Params() map[string]interface{}
+}
+
+// FilesPage is a Page that has more files to save along with it than
+// the images of its content, by their names in the bundle and the URLs
+// to get them from.
+type FilesPage interface {
+	Files() map[string]string
+}
+
+// Comment is a comment to a post.
+type Comment interface {
+	Author() Author
+	Content() Content
+	URL() string
+	Date() string
+}
+
+// Author is the author of a comment or a reaction.
+type Author struct {
+	Type  string `json:"type,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Url   string `json:"url,omitempty"`
+	Photo string `json:"photo,omitempty"`
+}
+
+// Content is the content of a comment, both as plain text and HTML.
+type Content struct {
+	Text string `json:"text,omitempty"`
+	Html string `json:"html,omitempty"`
+}
+
+// Mention is a comment or a reaction as webmention.io would have it.
+type Mention struct {
+	Type     string  `json:"type,omitempty"`
+	Property string  `json:"wm-property,omitempty"`
+	Author   Author  `json:"author"`
+	Url      string  `json:"url,omitempty"`
+	Date     string  `json:"wm-received"`
+	Content  Content `json:"content,omitempty"`
+	Parent   string  `json:"in-reply-to,omitempty"`
+	State    string  `json:"state,omitempty"`
+}
+
+// Reply returns the mention for the comment.
+func Reply(c Comment) Mention {
+	return Mention{
+		Type:     "entry",
+		Property: "in-reply-to",
+		Author:   c.Author(),
+		Url:      c.URL(),
+		Date:     c.Date(),
+		Content:  c.Content(),
+	}
+}
+
+// Feed returns the mentions as a JF2 feed, or nil if there are none.
+func Feed(mentions []Mention) []byte {
+	if len(mentions) == 0 {
+		return nil
+	}
+	var feed = struct {
+		Type     string    `json:"type"`
+		Name     string    `json:"name"`
+		Children []Mention `json:"children,omitempty"`
+	}{Type: "feed", Name: "Webmentions", Children: mentions}
+	b, err := json.MarshalIndent(feed, "", " ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Importer is a source of posts that can be converted from a local
+// backup.
+type Importer struct {
+	// Name is what the source is called with the -type option.
+	Name        string
+	Description string
+	// Detect tells whether the file looks like it's from a backup of
+	// this source.
+	Detect func(path string) bool
+	// Load returns the posts the file of the backup has, if any.
+	Load func(path string) ([]Page, error)
+}
+
+var registry = struct {
+	sync.Mutex
+	m map[string]Importer
+}{m: map[string]Importer{}}
+
+// Register makes the importer available by its name. It panics if the
+// name is taken or the importer can't load anything.
+func Register(i Importer) {
+	registry.Lock()
+	defer registry.Unlock()
+	if i.Name == "" || i.Load == nil {
+		panic("importer: no name or no Load for importer")
+	}
+	if _, ok := registry.m[i.Name]; ok {
+		panic(fmt.Sprintf("importer: %s registered twice", i.Name))
+	}
+	registry.m[i.Name] = i
+}
+
+// Lookup returns the importer registered under the name.
+func Lookup(name string) (Importer, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	i, ok := registry.m[name]
+	return i, ok
+}
+
+// All returns the importers registered, sorted by name.
+func All() []Importer {
+	registry.Lock()
+	defer registry.Unlock()
+	var all []Importer
+	for _, i := range registry.m {
+		all = append(all, i)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].Name < all[b].Name })
+	return all
+}
+
+// maxDetect is how many files Detect looks at before it gives up.
+const maxDetect = 100
+
+// errStop stops the walk Detect makes.
+var errStop = errors.New("stop")
+
+// Detect returns the importer the files in the directory look like they
+// are for.
+func Detect(dir string) (Importer, bool) {
+	all := All()
+	var found Importer
+	n := 0
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		for _, i := range all {
+			if i.Detect != nil && i.Detect(path) {
+				found = i
+				return errStop
+			}
+		}
+		if n++; n >= maxDetect {
+			return errStop
+		}
+		return nil
+	})
+	return found, found.Name != ""
+}
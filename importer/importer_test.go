@@ -0,0 +1,107 @@
+// Copyright (C) 2020 Evgeny Kuznetsov (evgeny@kuznetsov.md)
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	load := func(string) ([]Page, error) { return nil, nil }
+	Register(Importer{Name: "zzz", Description: "last", Load: load})
+	Register(Importer{Name: "aaa", Description: "first", Load: load})
+
+	if i, ok := Lookup("zzz"); !ok || i.Description != "last" {
+		t.Fatalf("want zzz, got %v", i)
+	}
+	if _, ok := Lookup("nope"); ok {
+		t.Fatal("want no importer")
+	}
+	all := All()
+	if len(all) != 2 || all[0].Name != "aaa" || all[1].Name != "zzz" {
+		t.Fatalf("want aaa and zzz, got %v", all)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic on the name taken")
+		}
+	}()
+	Register(Importer{Name: "aaa", Load: load})
+}
+
+func TestDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "post.detect"), []byte("post"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Detect(dir); ok {
+		t.Fatal("want nothing detected")
+	}
+	Register(Importer{
+		Name:   "detect",
+		Detect: func(path string) bool { return strings.HasSuffix(path, ".detect") },
+		Load:   func(string) ([]Page, error) { return nil, nil },
+	})
+	if i, ok := Detect(dir); !ok || i.Name != "detect" {
+		t.Fatalf("want detect, got %v", i)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	if b := Feed(nil); b != nil {
+		t.Fatalf("want nil, got %s", b)
+	}
+	b := Feed([]Mention{Reply(testComment{})})
+	want := `{
+ "type": "feed",
+ "name": "Webmentions",
+ "children": [
+  {
+   "type": "entry",
+   "wm-property": "in-reply-to",
+   "author": {
+    "type": "card",
+    "name": "someone"
+   },
+   "url": "https://example.com/1",
+   "wm-received": "2020-01-02",
+   "content": {
+    "text": "hi"
+   }
+  }
+ ]
+}`
+	if string(b) != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, b)
+	}
+}
+
+type testComment struct{}
+
+func (testComment) Author() Author   { return Author{Type: "card", Name: "someone"} }
+func (testComment) Content() Content { return Content{Text: "hi"} }
+func (testComment) URL() string      { return "https://example.com/1" }
+func (testComment) Date() string     { return "2020-01-02" }
@@ -18,564 +18,176 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/BurntSushi/toml"
-	"github.com/JohannesKaufmann/html-to-markdown"
-	"github.com/PuerkitoBio/goquery"
-)
-
-var (
-	outputDir, website, what, inputDir, siteType string
-	concurrency                                  int
-	draft                                        bool
+	"evgenykuznetsov.org/go/known-to-hugo/convert"
+	"evgenykuznetsov.org/go/known-to-hugo/importer"
 )
 
 var version string = "custom"
 
-const frontMatterSeparator = "+++\n"
-
-type content struct {
-	Text string `json:"text,omitempty"`
-	Html string `json:"html,omitempty"`
-}
-type author struct {
-	Type  string `json:"type,omitempty"`
-	Name  string `json:"name,omitempty"`
-	Url   string `json:"url,omitempty"`
-	Photo string `json:"photo,omitempty"`
-}
-type mention struct {
-	Type     string  `json:"type,omitempty"`
-	Property string  `json:"wm-property,omitempty"`
-	Author   author  `json:"author"`
-	Url      string  `json:"url,omitempty"`
-	Date     string  `json:"wm-received"`
-	Content  content `json:"content,omitempty"`
-}
-
 func main() {
 	fmt.Printf("known-to-hugo version %s\n", version)
-	flag.BoolVar(&draft, "d", false, "mark each entry as draft")
-	flag.IntVar(&concurrency, "c", 15, "number of pages to process simultaneously")
-	flag.StringVar(&website, "w", "example.site", "website to scrape")
+	if len(os.Args) > 1 && os.Args[1] == "send-webmentions" {
+		sendWebmentions(os.Args[2:])
+		return
+	}
+
+	var outputDir, inputDir, siteType, report, logFile, logFormat string
+	var verbose, quiet bool
+	o := convert.DefaultOptions()
+	flag.BoolVar(&o.Draft, "d", o.Draft, "mark each entry as draft")
+	flag.IntVar(&o.Concurrency, "c", o.Concurrency, "number of pages to process simultaneously")
+	flag.StringVar(&o.Website, "w", "example.site", "website to scrape")
 	flag.StringVar(&outputDir, "p", "./known_website", "directory to save the results to")
-	flag.StringVar(&what, "ww", "/content/posts", "section of the site to scrape, use \"\" for default content)")
+	flag.StringVar(&o.Section, "ww", o.Section, "section of the site to scrape, use \"\" for default content)")
 	flag.StringVar(&inputDir, "dir", "", "input directory")
-	flag.StringVar(&siteType, "type", "", "kind of website")
+	flag.StringVar(&siteType, "type", "", typeUsage())
+	flag.StringVar(&o.Embeds, "embeds", o.Embeds, "comma-separated list of embeds to convert to Hugo shortcodes")
+	flag.StringVar(&o.Format, "f", o.Format, "output format: \"md\", \"html\", or \"hybrid\" for HTML only where markdown would lose formatting")
+	flag.BoolVar(&o.ReplyContexts, "rc", o.ReplyContexts, "fetch reply contexts for replies, likes and reposts")
+	flag.BoolVar(&o.AutoTitles, "t", o.AutoTitles, "make up titles for untitled posts from their first sentence, and slugs for those that only have IDs")
+	flag.IntVar(&o.TitleWords, "tw", o.TitleWords, "maximum number of words in a made-up title")
+	flag.StringVar(&o.Slugs, "slugs", o.Slugs, "slugs to save the posts under: \"keep\", \"gost\" or \"passport\" to transliterate, or \"id\"")
+	flag.BoolVar(&o.Summaries, "sum", o.Summaries, "add summaries and descriptions to the front matter")
+	flag.StringVar(&o.Lang, "lang", o.Lang, "detect the language of each post and save it as the \"key\" in the front matter or in the content \"file\" name")
+	flag.BoolVar(&o.Hashtags, "ht", o.Hashtags, "add the #hashtags found in the posts to their tags")
+	flag.StringVar(&o.HashtagBase, "htl", o.HashtagBase, "link the hashtags to the tag pages under this path, e.g. /tags/")
+	flag.StringVar(&o.LJSecurity, "ljsec", o.LJSecurity, "what to do with LiveJournal entries that are not public: \"publish\", \"draft\" or \"skip\", for all of them or per level, e.g. \"friends=draft,private=skip\"")
+	flag.StringVar(&o.Charset, "charset", o.Charset, "encoding of the local backup files, e.g. \"windows-1251\", if it can't be detected")
+	flag.BoolVar(&o.LJScreened, "ljscr", o.LJScreened, "keep the screened LiveJournal comments, marked as such")
+	flag.StringVar(&report, "report", "known-to-hugo-errors.json", "file to save the JSON report on the posts that failed to convert to")
+	flag.BoolVar(&verbose, "v", false, "verbose: log every image and file downloaded, too")
+	flag.BoolVar(&quiet, "q", false, "quiet: only log warnings and errors")
+	flag.StringVar(&logFile, "log-file", "", "file to append the log to instead of the standard error")
+	flag.StringVar(&logFormat, "log-format", convert.LogText, "log format: \"text\" or \"json\"")
 	flag.Parse()
-	if !strings.HasPrefix(website, "http://") && !strings.HasPrefix(website, "https://") {
-		website = "http://" + website
-	}
-
-	if inputDir != "" {
-		processDirectory()
-	} else {
-
-		pages := getPostLinks(website + what)
-		defImg := getDefaultImage(website)
-		processPages(pages, defImg)
-	}
-	fmt.Println("all done!")
-}
-
-func processDirectory() {
-	switch siteType {
-	case "diary.ru":
-		blogDir(inputDir, outputDir, "diary")
-	case "lj_backup":
-		blogDir(inputDir, outputDir, "ljbackup")
-	case "gplus":
-		blogDir(inputDir, outputDir, "gplus")
-	default:
-		fmt.Println("not implemented")
-	}
-}
-
-func processPages(pages []string, defaultImage string) {
-	var errors []error
-	errC := make(chan error)
-	counter := 0
-	sem := make(chan struct{}, concurrency)
-	for _, page := range pages {
-		counter = counter + 1
-		go processPage(sem, errC, page, defaultImage)
-	}
-	for i := 0; i < counter; i++ {
-		err := <-errC
-		if err != nil {
-			errors = append(errors, err)
-		}
-	}
-	if len(errors) > 0 {
-		fmt.Printf("the following %v errors occurred:\n", len(errors))
-		for _, err := range errors {
-			fmt.Println(err)
-		}
-	}
-}
-
-func processPage(sem chan struct{}, errC chan error, url, defaultImage string) {
-	sem <- struct{}{}
-	defer func() { <-sem }()
 
-	fmt.Printf("processing %s\n", url)
-	d, err := getPage(url)
+	l, closeLog, err := newLogger(logFile, logFormat, verbose, quiet)
 	if err != nil {
-		err := fmt.Errorf("could not process %s - %w", url, err)
-		errC <- err
-		return
-	}
-	sel := d.Find("html")
-	year := getPostYear(sel)
-	slug := getPostSlug(url, year)
-	dir := filepath.Join(outputDir, year, slug)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		panic(err)
-	}
-	processWebmentions(sel, dir)
-	processImages(sel, dir)
-	processLinksToFiles(sel, dir)
-	processLinksToOwnSite(sel)
-	b := parsePage(sel, defaultImage)
-	fn := filepath.Join(dir, "index.md")
-	if err := ioutil.WriteFile(fn, b, 0644); err != nil {
-		panic(err)
-	}
-	errC <- nil
-}
-
-func processWebmentions(sel *goquery.Selection, path string) {
-	if b, ok := getWebmentions(sel); ok {
-		fn := filepath.Join(path, "webmentions.json")
-		if err := ioutil.WriteFile(fn, b, 0644); err != nil {
-			panic(err)
-		}
-	}
-}
-
-func getWebmentions(sel *goquery.Selection) ([]byte, bool) {
-	var mentions = struct {
-		Type     string    `json:"type"`
-		Name     string    `json:"name"`
-		Children []mention `json:"children,omitempty"`
-	}{Type: "feed", Name: "Webmentions"}
-
-	sel.Find(".annotations").Find(".idno-annotation").Each(func(i int, s *goquery.Selection) {
-		m := getMention(s)
-		mentions.Children = append(mentions.Children, m)
-	})
-	if len(mentions.Children) > 0 {
-		b, err := json.MarshalIndent(mentions, "", " ")
-		if err != nil {
-			panic(err)
-		}
-		return b, true
-	}
-	return nil, false
-}
-
-func getMention(sel *goquery.Selection) mention {
-	var m = mention{
-		Type:   "entry",
-		Author: getMentionAuthor(sel),
-	}
-	if c, ok := getMentionContent(sel); ok {
-		m.Content = c
-	}
-	if t, ok := getMentionType(sel); ok {
-		m.Property = t
-	}
-	m.Url, m.Date = getMentionSource(sel)
-	return m
-}
-
-func getMentionType(sel *goquery.Selection) (string, bool) {
-	s := sel.Find(".idno-annotation-content").Find("p").Eq(0)
-	if s.Parent().Is(".e-content") {
-		return "comment", false
+		fmt.Printf("%v\n", err)
+		os.Exit(2)
 	}
-	a := s.Find("a").Eq(1).Text()
-	if strings.HasPrefix(a, "reshared") {
-		return "repost-of", true
-	}
-	a = s.Text()
-	if strings.HasSuffix(strings.TrimSpace(a), "liked this post") {
-		return "like-of", true
-	}
-	return a, true
-}
+	defer closeLog()
+	o.Logger = l
 
-func getMentionSource(sel *goquery.Selection) (url, date string) {
-	s := sel.Find(".idno-annotation-content").Find("a").Eq(-2)
-	d := s.Text()
-	dt, err := time.Parse("Jan 02 2006", d)
+	c, err := convert.New(o)
 	if err != nil {
-		date = d
-	} else {
-		date = dt.Format("2006-01-02")
-	}
-	url, _ = s.Attr("href")
-	return
-}
-
-func getMentionAuthor(sel *goquery.Selection) author {
-	p, _ := sel.Find(".idno-annotation-image").Find("img").Attr("src")
-	au := sel.Find(".idno-annotation-content").Find("a").Eq(0)
-	n := au.Text()
-	u, _ := au.Attr("href")
-	s := sel.Find(".h-card")
-	if s.Is(".h-card") {
-		n = s.Find(".p-name").Text()
-		u, _ = s.Find(".p-name").Attr("href")
-		p, _ = s.Find(".u-photo").Attr("href")
-	}
-	return author{"card", n, u, p}
-}
-
-func getMentionContent(sel *goquery.Selection) (content, bool) {
-	cont := sel.Find(".e-content")
-	if cont.Is(".e-content") {
-		text := cont.Text()
-		html, _ := cont.Html()
-		return content{text, html}, true
+		l.Error(err.Error())
+		closeLog()
+		os.Exit(2)
 	}
-	return content{}, false
-}
-
-func processLinksToOwnSite(sel *goquery.Selection) {
-	prefix := strings.TrimSuffix(website, "/")
-	sel.Find(".e-content").Find("a").Each(func(i int, s *goquery.Selection) {
-		link, _ := s.Attr("href")
-		rel := strings.TrimPrefix(link, prefix)
-		s.SetAttr("href", rel)
-	})
-}
-
-func processLinksToFiles(sel *goquery.Selection, dir string) {
-	fPrefix := strings.TrimSuffix(website, "/") + "/file/"
-	se := sel.Find(".e-content")
-	se.Find("a").Each(func(i int, s *goquery.Selection) {
-		link, _ := s.Attr("href")
-		if strings.HasPrefix(link, fPrefix) {
-			pts := strings.Split(link, "/")
-			fn := strconv.Itoa(i) + pts[len(pts)-1]
-			filename := filepath.Join(dir, fn)
-			if err := downloadFile(filename, link); err != nil {
-				fmt.Printf("failed to fetch asset: %s - %v", link, err)
-				return
-			}
-			changeHrefs(se, link, fn)
-		}
-	})
-}
 
-func processImages(sel *goquery.Selection, dir string) {
-	featured := getFeaturedImage(sel)
-	se := sel.Find(".e-content")
-	se.Find("img").Each(func(i int, s *goquery.Selection) {
-		link, _ := s.Attr("src")
-		photoUrl := strings.TrimSuffix(link, "/thumb.jpg")
-		fn := "image" + strconv.Itoa(i)
-		filename := filepath.Join(dir, fn)
-		if err := downloadFile(filename, photoUrl); err != nil {
-			fmt.Printf("failed to fetch image: %s - %v", photoUrl, err)
-			return
-		}
-
-		// fix hrefs
-		changeHrefs(se, link, fn)
-
-		// fix featured image, too
-		if link == featured {
-			sel.Find("meta").Each(func(i int, s *goquery.Selection) {
-				v, _ := s.Attr("property")
-				if v == "og:image" {
-					s.SetAttr("content", fn)
-				}
-			})
-		}
-		s.SetAttr("src", fn)
-	})
-}
-
-func changeHrefs(se *goquery.Selection, link, fn string) {
-	se.Find("a").Each(func(i int, s *goquery.Selection) {
-		href, _ := s.Attr("href")
-		if href == link {
-			s.SetAttr("href", fn)
-		}
-	})
-}
-
-func getPostSlug(uri, year string) string {
-	u, err := url.Parse(uri)
-	if err != nil {
-		// Known is buggy as hell
-		uf := fixURL(uri)
-		u, err = url.Parse(uf)
-		if err != nil {
-			panic(err)
-		}
+	done := make(chan struct{})
+	go reportProgress(l, c, done)
+	if inputDir != "" {
+		err = c.ImportDir(inputDir, siteType, outputDir)
+	} else {
+		err = c.Scrape(outputDir)
 	}
-	slug := strings.TrimPrefix(u.Path, "/"+year+"/")
-	return slug
-}
-
-func getPostYear(sel *goquery.Selection) string {
-	dateString := getDtPublished(sel)
-	date, err := time.Parse("2006-01-02T15:04:05-0700", dateString)
+	close(done)
 	if err != nil {
-		panic(err)
+		l.Error(err.Error())
+		closeLog()
+		os.Exit(1)
 	}
-	return date.Format("2006")
-}
-
-func getPostLinks(url string) []string {
-	var links []string
-	next := true
-	for next {
-		fmt.Printf("Processing %s\n", url)
-		d, err := getPage(url)
-		if err != nil {
-			break
-		}
-		s := d.Find("html")
-		var nurl string
-		nurl, next = s.Find(".older").Find("a").Attr("href")
-		// Known is buggy as hell:
-		if nurl == url {
-			next = false
-		}
-		url = nurl
-		links = append(links, getPostLinksFromPage(s)...)
-	}
-	return links
-}
-
-func getPostLinksFromPage(sel *goquery.Selection) []string {
-	var links []string
-	sel.Find(".idno-entry").Each(func(i int, s *goquery.Selection) {
-		link := getPermalink(s)
-		links = append(links, link)
-	})
-	return links
-}
-
-func parsePage(sel *goquery.Selection, defaultImage string) []byte {
-	var b []byte
-	b = append(b, getFrontMatter(sel, defaultImage)...)
-	b = append(b, []byte(getMd(sel))...)
-	return b
-}
-
-func getFrontMatter(sel *goquery.Selection, defaultImage string) []byte {
-	featured := getFeaturedImage(sel)
-	if featured == defaultImage {
-		featured = ""
-	}
-
-	var frontMatter = map[string]interface{}{
-		"title":          getTitle(sel),
-		"aliases":        []string{getRelPermalink(sel)},
-		"date":           getDtPublished(sel),
-		"featured_image": featured,
-		"tags":           getTags(sel),
-		"reply_to":       getInReply(sel),
-		"posse":          getSyndications(sel),
-		"like_of":        getLikeOf(sel),
-		"draft":          draft,
-	}
-	buf := new(bytes.Buffer)
-	if err := toml.NewEncoder(buf).Encode(frontMatter); err != nil {
-		panic(err)
-	}
-	var b []byte
-	b = append(b, []byte(frontMatterSeparator)...)
-	b = append(b, buf.Bytes()...)
-	b = append(b, []byte(frontMatterSeparator)...)
-	return b
-}
+	p := c.Progress()
+	l.Info("progress", "discovered", p.Discovered, "processed", p.Processed, "failed", p.Failed, "assets", p.Assets)
 
-func getMd(sel *goquery.Selection) string {
-	c := sel.Clone()
-	converter := md.NewConverter("", true, nil)
-	c.Find(".annotations").Remove()
-	c.Find(".p-category").Remove()
-	got := converter.Convert(c.Find(".e-content"))
-	return got
-}
-
-func getInReply(sel *goquery.Selection) []string {
-	var irt []string
-	sel.Find(".u-in-reply-to").Each(func(i int, s *goquery.Selection) {
-		rep, _ := s.Attr("href")
-		irt = append(irt, rep)
-	})
-	return irt
-}
-
-func getLikeOf(sel *goquery.Selection) string {
-	s := sel.Find(".u-like-of")
-	// Known is awesome :/
-	var like string
-	if l, ok := s.Attr("href"); ok {
-		if l != "" {
-			like = l
+	if failures := c.Failures(); len(failures) > 0 {
+		if err := convert.WriteReport(report, failures); err != nil {
+			l.Error("failed to save the report", "file", report, "error", err)
 		} else {
-			like, _ = sel.Find(".unfurl").Attr("data-url")
+			l.Warn("some posts failed, see the report", "errors", len(failures), "file", report)
 		}
+		closeLog()
+		os.Exit(1)
 	}
-	return like
-}
-
-func getSyndications(sel *goquery.Selection) []string {
-	var irt []string
-	sel.Find(".u-syndication").Each(func(i int, s *goquery.Selection) {
-		rep, _ := s.Attr("href")
-		irt = append(irt, rep)
-	})
-	return irt
-}
-
-func getTags(sel *goquery.Selection) []string {
-	var tags []string
-	sel.Find(".p-category").Each(func(i int, s *goquery.Selection) {
-		tag := strings.TrimPrefix(s.Text(), "#")
-		tags = append(tags, tag)
-	})
-	return tags
+	l.Info("all done!")
 }
 
-func getFeaturedImage(sel *goquery.Selection) string {
-	var img string
-	sel.Find("meta").Each(func(i int, s *goquery.Selection) {
-		v, _ := s.Attr("property")
-		if v == "og:image" {
-			img, _ = s.Attr("content")
-		}
-	})
-	return img
-}
+// sendWebmentions runs the send-webmentions command with its arguments.
+func sendWebmentions(args []string) {
+	var o convert.WebmentionOptions
+	fs := flag.NewFlagSet("send-webmentions", flag.ExitOnError)
+	fs.StringVar(&o.Dir, "p", "./known_website", "directory with the generated bundles")
+	fs.StringVar(&o.Site, "s", "", "base URL the bundles are published under, e.g. https://example.site/posts")
+	fs.StringVar(&o.State, "state", "webmentions-sent.json", "file to keep track of the webmentions already sent")
+	fs.BoolVar(&o.DryRun, "n", false, "dry run: discover endpoints, but don't send anything")
+	_ = fs.Parse(args)
 
-func getDefaultImage(url string) string {
-	d, err := getPage(url)
+	l, err := convert.NewLogger(os.Stderr, convert.LevelInfo, convert.LogText)
 	if err != nil {
-		return ""
+		fmt.Printf("%v\n", err)
+		os.Exit(2)
+	}
+	if o.Site == "" {
+		l.Error("base URL (-s) is required")
+		os.Exit(2)
+	}
+	o.Logger = l
+	if err := convert.SendWebmentions(o); err != nil {
+		l.Error("failed to send webmentions", "error", err)
+		os.Exit(1)
 	}
-	s := d.Find("html")
-	return getFeaturedImage(s)
-}
-
-func getTitle(sel *goquery.Selection) string {
-	v := sel.Find(".idno-body").Find(".p-name").Find("a").Text()
-	return v
 }
 
-func getPermalink(sel *goquery.Selection) string {
-	v, _ := sel.Find(".permalink").Find(".u-url").Attr("href")
-	v, _ = url.PathUnescape(v)
-	return v
-}
+// progressInterval is how often the progress is logged.
+const progressInterval = 10 * time.Second
 
-func getRelPermalink(sel *goquery.Selection) string {
-	link := getPermalink(sel)
-	u, err := url.Parse(link)
-	if err != nil {
-		// Known is buggy as hell
-		uf := fixURL(link)
-		u, err = url.Parse(uf)
-		if err != nil {
-			panic(err)
+// reportProgress logs the progress of the converter until done is
+// closed.
+func reportProgress(l *convert.Logger, c *convert.Converter, done chan struct{}) {
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			p := c.Progress()
+			l.Info("progress", "discovered", p.Discovered, "processed", p.Processed, "failed", p.Failed, "assets", p.Assets)
 		}
 	}
-	return u.Path
-}
-
-func getDtPublished(sel *goquery.Selection) string {
-	v, _ := sel.Find(".dt-published").Attr("datetime")
-	return v
 }
 
-func getPage(uri string) (*goquery.Document, error) {
-	res, err := http.Get(uri)
-	if err != nil {
-		// Known is buggy as hell
-		u := fixURL(uri)
-		res, err = http.Get(u)
-		if err != nil {
-			return nil, fmt.Errorf("can not parse URL")
-		}
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		err := fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
-		return nil, fmt.Errorf("can not get page: %w", err)
+// newLogger returns the logger the flags ask for, and the function to
+// close the log file.
+func newLogger(fn, format string, verbose, quiet bool) (*convert.Logger, func(), error) {
+	level := convert.LevelInfo
+	if verbose {
+		level = convert.LevelDebug
 	}
-
-	// Load the HTML document
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		panic(err)
+	if quiet {
+		level = convert.LevelWarn
 	}
-
-	return doc, nil
-}
-
-func fixURL(uri string) string {
-	pth := strings.TrimPrefix(uri, website)
-	pth = strings.TrimPrefix(pth, "/")
-	comps := strings.SplitN(pth, "/", 2)
-	if len(comps) < 2 {
-		return ""
+	if fn == "" {
+		l, err := convert.NewLogger(os.Stderr, level, format)
+		return l, func() {}, err
 	}
-	parts := []string{website, comps[0], url.PathEscape(comps[1])}
-	res := strings.Join(parts, "/")
-	return res
-}
 
-func downloadFile(filepath string, url string) error {
-
-	// Get the data
-	resp, err := http.Get(url)
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
-
-	// Create the file
-	out, err := os.Create(filepath)
+	l, err := convert.NewLogger(f, level, format)
 	if err != nil {
-		return err
+		f.Close()
+		return nil, nil, err
 	}
-	defer out.Close()
-
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	return l, func() { f.Close() }, nil
 }
 
-func downloadImages(path string, images map[string]string) {
-	for fn, url := range images {
-		filename := filepath.Join(path, fn)
-		if err := downloadFile(filename, url); err != nil {
-			fmt.Printf("failed to fetch image: %s - %v\n", url, err)
-			b := []byte(url)
-			if err := ioutil.WriteFile(filename, b, 0644); err != nil {
-				fmt.Println(err)
-			}
-		}
+// typeUsage returns the help on -type, listing the importers registered.
+func typeUsage() string {
+	var b strings.Builder
+	b.WriteString("kind of website to import the -dir backup of, detected if not set:")
+	for _, i := range importer.All() {
+		fmt.Fprintf(&b, "\n\t%q: %s", i.Name, i.Description)
 	}
+	return b.String()
 }